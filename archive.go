@@ -0,0 +1,134 @@
+package pdfhandler
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"path"
+	"time"
+)
+
+// archiveExtensions are the file extensions of the archive formats batch
+// output can be written in, by mimetype.
+var archiveExtensions = map[string]string{
+	"application/zip":   ".zip",
+	"application/x-tar": ".tar",
+	"application/gzip":  ".tar.gz",
+	"multipart/mixed":   "",
+}
+
+func isArchive(mimetype string) bool {
+	_, ok := archiveExtensions[mimetype]
+	return ok
+}
+
+// archiveWriter writes the files of batch output one after another.
+type archiveWriter interface {
+	// create starts a file called name that is size bytes long.
+	create(name string, size int64) (io.Writer, error)
+	Close() error
+}
+
+// newArchiveWriter writes batch output as mimetype to w, boundary is the
+// boundary of multipart output.
+func newArchiveWriter(mimetype string, w io.Writer, boundary string) (archiveWriter, error) {
+	switch mimetype {
+	case "application/x-tar":
+		return tarWriter{tw: tar.NewWriter(w)}, nil
+	case "application/gzip":
+		gz := gzip.NewWriter(w)
+		return tarWriter{tw: tar.NewWriter(gz), gz: gz}, nil
+	case "multipart/mixed":
+		mw := multipart.NewWriter(w)
+		if err := mw.SetBoundary(boundary); err != nil {
+			return nil, err
+		}
+		return multipartWriter{mw}, nil
+	}
+	return zipWriter{zip.NewWriter(w)}, nil
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (z zipWriter) create(name string, size int64) (io.Writer, error) {
+	header := &zip.FileHeader{
+		Name:   name,
+		Method: zip.Deflate,
+	}
+	header.SetModTime(time.Now())
+	return z.zw.CreateHeader(header)
+}
+
+func (z zipWriter) Close() error {
+	return z.zw.Close()
+}
+
+// tarWriter writes a tar, gzipped if gz is set. Every file is written as
+// soon as it is created, there is no central directory.
+type tarWriter struct {
+	tw *tar.Writer
+	gz *gzip.Writer
+}
+
+func (t tarWriter) create(name string, size int64) (io.Writer, error) {
+	err := t.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  time.Now(),
+	})
+	return t.tw, err
+}
+
+func (t tarWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	if t.gz != nil {
+		return t.gz.Close()
+	}
+	return nil
+}
+
+// multipartWriter writes every file as a part of a multipart/mixed body.
+type multipartWriter struct {
+	mw *multipart.Writer
+}
+
+func (m multipartWriter) create(name string, size int64) (io.Writer, error) {
+	ct := mime.TypeByExtension(path.Ext(name))
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", ct)
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	return m.mw.CreatePart(h)
+}
+
+func (m multipartWriter) Close() error {
+	return m.mw.Close()
+}
+
+// writeJSONEntry adds v to a as the json file name.
+func writeJSONEntry(a archiveWriter, name string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	f, err := a.create(name, int64(len(b)))
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	return err
+}
@@ -0,0 +1,123 @@
+package pdfhandler
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readTar returns the files of a tar stream, gzip compressed for
+// application/gzip, by name and the names in order.
+func readTar(t *testing.T, accept string, b []byte) (map[string][]byte, []string) {
+	var r io.Reader = bytes.NewReader(b)
+	if accept == "application/gzip" {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	files := map[string][]byte{}
+	names := []string{}
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[h.Name] = b
+		names = append(names, h.Name)
+	}
+	return files, names
+}
+
+func TestPostMultiTar(t *testing.T) {
+	SetLogger(&testLogger{t})
+	for accept, ext := range map[string]string{"application/x-tar": ".tar", "application/gzip": ".tar.gz"} {
+		resp, b := postJSON(t, pdfHandler, accept, multi)
+		requireOK(t, resp, b)
+		files, names := readTar(t, accept, b)
+		assert.Equal(t, accept, resp.Header.Get("Content-Type"))
+		assert.True(t, strings.HasSuffix(resp.Header.Get("Content-Disposition"), ext))
+		assert.Equal(t, []string{"OoPdfFormExample.pdf", "OoPdfFormExample (2).pdf"}, names)
+		for _, b := range files {
+			assert.True(t, bytes.HasPrefix(b, []byte("%PDF")))
+		}
+	}
+}
+
+func TestPostTarManifest(t *testing.T) {
+	SetLogger(&testLogger{t})
+	body := map[string]interface{}{"documents": multi, "manifest": true}
+	resp, b := postJSON(t, pdfHandler, "application/gzip", body)
+	requireOK(t, resp, b)
+	files, names := readTar(t, "application/gzip", b)
+	assert.Equal(t, "manifest.json", names[len(names)-1])
+	var m manifest
+	if err := json.Unmarshal(files["manifest.json"], &m); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, m.Documents, 2)
+}
+
+func TestPostBurstTar(t *testing.T) {
+	SetLogger(&testLogger{t})
+	resp, b := postJSON(t, atPath("/burst", pdfHandler), "application/x-tar", single)
+	requireOK(t, resp, b)
+	files, _ := readTar(t, "application/x-tar", b)
+	assert.NotEmpty(t, files)
+	for name := range files {
+		assert.True(t, strings.HasPrefix(name, "OoPdfFormExample-p"), name)
+	}
+}
+
+func TestPostMultiMultipart(t *testing.T) {
+	SetLogger(&testLogger{t})
+	resp, b := postJSON(t, pdfHandler, "multipart/mixed", map[string]interface{}{"documents": multi, "manifest": true})
+	requireOK(t, resp, b)
+	mt, params, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "multipart/mixed", mt)
+	mr := multipart.NewReader(bytes.NewReader(b), params["boundary"])
+	names := []string{}
+	types := []string{}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NotEmpty(t, b)
+		names = append(names, part.FileName())
+		types = append(types, part.Header.Get("Content-Type"))
+	}
+	assert.Equal(t, []string{"OoPdfFormExample.pdf", "OoPdfFormExample (2).pdf", "manifest.json"}, names)
+	assert.Equal(t, "application/pdf", types[0])
+	assert.Equal(t, "application/pdf", types[1])
+	assert.True(t, strings.HasPrefix(types[2], "application/json"))
+}
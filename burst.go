@@ -0,0 +1,17 @@
+package pdfhandler
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// pageFileName names page n of the document called name in burst output,
+// e.g. myfile-p001.pdf.
+func pageFileName(name string, n int) string {
+	name = strings.TrimSuffix(name, path.Ext(name))
+	if name == "" {
+		name = "document"
+	}
+	return fmt.Sprintf("%s-p%03d.pdf", name, n)
+}
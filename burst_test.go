@@ -0,0 +1,18 @@
+package pdfhandler
+
+import (
+	"testing"
+)
+
+func TestPageFileName(t *testing.T) {
+	for filename, expected := range map[string]string{
+		"OoPdfFormExample.pdf": "OoPdfFormExample-p012.pdf",
+		"scan":                 "scan-p012.pdf",
+		"":                     "document-p012.pdf",
+		"invoices/1234.pdf":    "invoices/1234-p012.pdf",
+	} {
+		if name := pageFileName(filename, 12); name != expected {
+			t.Fatalf("Expected %q, got %q", expected, name)
+		}
+	}
+}
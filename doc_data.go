@@ -0,0 +1,130 @@
+package pdfhandler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PageBox is a rectangle in default user space, lower left to upper right.
+type PageBox struct {
+	X1, Y1, X2, Y2 float64
+}
+
+func (b PageBox) width() float64  { return b.X2 - b.X1 }
+func (b PageBox) height() float64 { return b.Y2 - b.Y1 }
+
+// PageMedia is the size and rotation of a page.
+type PageMedia struct {
+	Number   int
+	Rotation int
+	Rect     PageBox
+}
+
+// Bookmark is an outline entry pointing at a page of the document.
+type Bookmark struct {
+	Title      string
+	Level      int
+	PageNumber int
+}
+
+// DocData is the subset of pdftk's dump_data report used by the handler.
+type DocData struct {
+	Info          map[string]string
+	Bookmarks     []Bookmark
+	NumberOfPages int
+	Media         []PageMedia
+}
+
+var (
+	infoEscaper   = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#13;", "\n", "&#10;")
+	infoUnescaper = strings.NewReplacer("&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", "\"", "&#13;", "\r", "&#10;", "\n")
+)
+
+// String returns d in the format read by pdftk update_info_utf8.
+func (d DocData) String() string {
+	var buf bytes.Buffer
+	keys := make([]string, 0, len(d.Info))
+	for k := range d.Info {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "InfoBegin\nInfoKey: %s\nInfoValue: %s\n", infoEscaper.Replace(k), infoEscaper.Replace(d.Info[k]))
+	}
+	for _, b := range d.Bookmarks {
+		fmt.Fprintf(&buf, "BookmarkBegin\nBookmarkTitle: %s\nBookmarkLevel: %d\nBookmarkPageNumber: %d\n",
+			infoEscaper.Replace(b.Title), b.Level, b.PageNumber)
+	}
+	return buf.String()
+}
+
+func scanDocData(r io.Reader) *DocData {
+	d := DocData{Info: make(map[string]string)}
+	key := ""
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		t := scanner.Text()
+		i := strings.Index(t, ":")
+		if i < 0 {
+			switch t {
+			case "BookmarkBegin":
+				d.Bookmarks = append(d.Bookmarks, Bookmark{})
+			case "PageMediaBegin":
+				d.Media = append(d.Media, PageMedia{})
+			}
+			continue
+		}
+		field, value := t[:i], strings.TrimSpace(t[i+1:])
+		switch field {
+		case "InfoKey":
+			key = infoUnescaper.Replace(value)
+		case "InfoValue":
+			d.Info[key] = infoUnescaper.Replace(value)
+		case "NumberOfPages":
+			d.NumberOfPages, _ = strconv.Atoi(value)
+		case "BookmarkTitle", "BookmarkLevel", "BookmarkPageNumber":
+			if len(d.Bookmarks) == 0 {
+				continue
+			}
+			b := &d.Bookmarks[len(d.Bookmarks)-1]
+			switch field {
+			case "BookmarkTitle":
+				b.Title = infoUnescaper.Replace(value)
+			case "BookmarkLevel":
+				b.Level, _ = strconv.Atoi(value)
+			case "BookmarkPageNumber":
+				b.PageNumber, _ = strconv.Atoi(value)
+			}
+		case "PageMediaNumber", "PageMediaRotation", "PageMediaRect":
+			if len(d.Media) == 0 {
+				continue
+			}
+			m := &d.Media[len(d.Media)-1]
+			switch field {
+			case "PageMediaNumber":
+				m.Number, _ = strconv.Atoi(value)
+			case "PageMediaRotation":
+				m.Rotation, _ = strconv.Atoi(value)
+			case "PageMediaRect":
+				m.Rect = parseBox(value)
+			}
+		}
+	}
+	return &d
+}
+
+func parseBox(s string) PageBox {
+	var v [4]float64
+	for i, f := range strings.Fields(strings.Replace(s, ",", " ", -1)) {
+		if i == len(v) {
+			break
+		}
+		v[i], _ = strconv.ParseFloat(f, 64)
+	}
+	return PageBox{v[0], v[1], v[2], v[3]}
+}
@@ -0,0 +1,62 @@
+package pdfhandler
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testDocData = `InfoBegin
+InfoKey: Title
+InfoValue: PDF Form Example
+NumberOfPages: 2
+PageMediaBegin
+PageMediaNumber: 1
+PageMediaRotation: 0
+PageMediaRect: 0 0 595 842
+PageMediaDimensions: 595 842
+PageMediaBegin
+PageMediaNumber: 2
+PageMediaRotation: 90
+PageMediaRect: 0 0 612 792
+PageMediaDimensions: 612 792
+`
+
+func TestScanDocData(t *testing.T) {
+	d := scanDocData(strings.NewReader(testDocData))
+	if d.NumberOfPages != 2 || len(d.Media) != 2 {
+		t.Fatalf("Unexpected doc data %+v", d)
+	}
+	if d.Media[1].Rotation != 90 || d.Media[1].Rect != (PageBox{0, 0, 612, 792}) {
+		t.Fatalf("Unexpected page media %+v", d.Media[1])
+	}
+}
+
+func TestDocDataInfo(t *testing.T) {
+	d := scanDocData(strings.NewReader(testDocData))
+	if d.Info["Title"] != "PDF Form Example" {
+		t.Fatalf("Unexpected info %v", d.Info)
+	}
+	d.Info["Subject"] = "Tom & Jerry <1>\nline two"
+	out := scanDocData(strings.NewReader(d.String()))
+	if out.Info["Subject"] != d.Info["Subject"] || out.Info["Title"] != d.Info["Title"] {
+		t.Fatalf("Expected %v, got %v", d.Info, out.Info)
+	}
+	if strings.Count(d.String(), "\n") != 6 {
+		t.Fatalf("Expected values to be escaped, got %q", d.String())
+	}
+}
+
+func TestDocDataBookmarks(t *testing.T) {
+	d := DocData{Bookmarks: []Bookmark{
+		{PDF{FileName: "OoPdfFormExample.pdf"}.title(), 1, 1},
+		{PDF{FileName: "OoPdfFormExample.pdf", Title: "Second"}.title(), 1, 2},
+	}}
+	out := scanDocData(strings.NewReader(d.String()))
+	if !reflect.DeepEqual(out.Bookmarks, d.Bookmarks) {
+		t.Fatalf("Expected %v, got %v", d.Bookmarks, out.Bookmarks)
+	}
+	if out.Bookmarks[0].Title != "OoPdfFormExample" {
+		t.Fatalf("Got title %q", out.Bookmarks[0].Title)
+	}
+}
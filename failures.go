@@ -0,0 +1,24 @@
+package pdfhandler
+
+import "fmt"
+
+// documentError is the failure of one document of a batch.
+type documentError struct {
+	index    int
+	filename string
+	err      error
+}
+
+func (e documentError) Error() string {
+	return fmt.Sprintf("Document %d (%s) failed: %s", e.index, e.filename, e.err)
+}
+
+// failure is an entry of errors.json, listing a document left out of
+// lenient batch output.
+type failure struct {
+	// Index is the position of the document in the request, from 0.
+	Index    int    `json:"index"`
+	FileName string `json:"filename"`
+	// Error is what went wrong, for pdftk its stderr.
+	Error string `json:"error"`
+}
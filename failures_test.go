@@ -0,0 +1,110 @@
+package pdfhandler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// brokenRenderer fails to fill documents with a "broken" field.
+type brokenRenderer struct {
+	Renderer
+}
+
+func (b brokenRenderer) Fill(ctx context.Context, w io.Writer, path string, fields map[string]string, flatten bool) error {
+	if _, ok := fields["broken"]; ok {
+		return errors.New("Error: Failed to open form data file")
+	}
+	return b.Renderer.Fill(ctx, w, path, fields, flatten)
+}
+
+// brokenHandler fails documents with a "broken" field.
+func brokenHandler(t *testing.T) *PDFHandler {
+	r, _ := testRenderer()
+	return newTestHandler(t, WithRenderer(brokenRenderer{r}))
+}
+
+// brokenBatch is a batch with a broken document between two good ones.
+func brokenBatch(onError string) map[string]interface{} {
+	broken := PDF{FileName: "OoPdfFormExample.pdf", Fields: map[string]string{"broken": "yes"}}
+	return map[string]interface{}{
+		"documents": []PDF{multi[0], broken, multi[1]},
+		"on_error":  onError,
+	}
+}
+
+func TestOnErrorStrict(t *testing.T) {
+	SetLogger(&testLogger{t})
+	for _, onError := range []string{"", "strict"} {
+		resp, body := postJSON(t, brokenHandler(t), "application/zip", brokenBatch(onError))
+		assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		assert.Contains(t, string(body), "Document 1 (OoPdfFormExample.pdf) failed")
+		assert.Contains(t, string(body), "Failed to open form data file")
+	}
+}
+
+func TestOnErrorLenientZip(t *testing.T) {
+	SetLogger(&testLogger{t})
+	resp, body := postJSON(t, brokenHandler(t), "application/zip", brokenBatch("lenient"))
+	if !assert.Equal(t, http.StatusOK, resp.StatusCode, string(body)) {
+		return
+	}
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	var failures []failure
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if f.Name != "errors.json" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.NewDecoder(rc).Decode(&failures)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Len(t, names, 3)
+	assert.Equal(t, "errors.json", names[len(names)-1])
+	assert.Equal(t, []failure{{1, "OoPdfFormExample.pdf", "Error: Failed to open form data file"}}, failures)
+}
+
+func TestOnErrorLenientPDF(t *testing.T) {
+	SetLogger(&testLogger{t})
+	resp, body := postJSON(t, brokenHandler(t), "application/pdf", brokenBatch("lenient"))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	one, err := ioutil.ReadFile("./pdf-test/OoPdfFormExample.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NativeRenderer{}.DocData(context.Background(), one)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := NativeRenderer{}.DocData(context.Background(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2*d.NumberOfPages, out.NumberOfPages)
+}
+
+func TestOnErrorInvalid(t *testing.T) {
+	SetLogger(&testLogger{t})
+	resp, body := postJSON(t, brokenHandler(t), "application/zip", brokenBatch("ignore"))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, string(body), "Invalid on_error")
+}
@@ -1,12 +1,13 @@
 package pdfhandler
 
 import (
-	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 )
@@ -15,45 +16,165 @@ type PDF struct {
 	FileName string            `json:"filename"`
 	Fields   map[string]string `json:"fields"`
 	Content  string            `json:"content"`
+
+	Title     string     `json:"title,omitempty"`
+	Pages     string     `json:"pages,omitempty"`
+	Copies    int        `json:"copies,omitempty"`
+	Watermark *Watermark `json:"watermark,omitempty"`
+	Flatten   bool       `json:"flatten,omitempty"`
+
+	// OutputName names the document in zip output instead of FileName.
+	// It may contain folders and {{.Fields.name}} lookups, e.g.
+	// "invoices/{{.Fields.invoice_no}}.pdf".
+	OutputName string `json:"output_name,omitempty"`
+
+	// URL names a template to download instead of one in the handler's
+	// directory, from a host allowed with WithTemplateHosts.
+	URL string `json:"url,omitempty"`
+
+	// content is a template uploaded as a form part, used instead of
+	// Content.
+	content []byte
+}
+
+// title is the bookmark title of the document in concatenated output.
+func (p PDF) title() string {
+	if p.Title != "" {
+		return p.Title
+	}
+	return strings.TrimSuffix(p.FileName, filepath.Ext(p.FileName))
+}
+
+// template names the template p is rendered from: its url, or else its
+// file name.
+func (p PDF) template() string {
+	if p.URL != "" {
+		return p.URL
+	}
+	return p.FileName
+}
+
+// check validates the settings of p that can be checked before rendering.
+func (p PDF) check() error {
+	if p.Copies < 0 || p.Copies > maxCopies {
+		return fmt.Errorf("Copies must be between 0 and %d", maxCopies)
+	}
+	if p.Pages != "" {
+		if _, err := parsePageSpec(p.Pages); err != nil {
+			return err
+		}
+	}
+	if p.Watermark != nil {
+		if err := p.Watermark.check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkDocuments validates pdfs, naming the first invalid document.
+func checkDocuments(pdfs []PDF) error {
+	for i, p := range pdfs {
+		if err := p.check(); err != nil {
+			return fmt.Errorf("Document %d (%s): %s", i, p.FileName, err)
+		}
+	}
+	return nil
+}
+
+// maxCopies caps the copies of a document when no document limit is set.
+const maxCopies = 1000
+
+// copies is the number of times the document appears in batch output.
+func (p PDF) copies() int {
+	if p.Copies < 1 {
+		return 1
+	}
+	return p.Copies
 }
 
-func (p PDF) render(rootPath string) ([]byte, error) {
+// steps are the steps that render p: filling it and then applying its
+// page selection and watermark.
+func (p PDF) steps(r Renderer, rootPath string) ([]step, error) {
+	steps := []step{func(ctx context.Context, w io.Writer, _ []byte) error {
+		return p.fill(ctx, r, rootPath, w)
+	}}
+	if p.Pages != "" {
+		ranges, err := parsePageSpec(p.Pages)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, func(ctx context.Context, w io.Writer, b []byte) error {
+			return r.SelectPages(ctx, w, b, ranges)
+		})
+	}
+	if p.Watermark != nil {
+		steps = append(steps, func(ctx context.Context, w io.Writer, b []byte) error {
+			return p.Watermark.stamp(ctx, r, w, b, p)
+		})
+	}
+	return steps, nil
+}
 
-	if p.Content != "" {
-		return p.decodeContent()
+func (p PDF) render(ctx context.Context, r Renderer, rootPath string, w io.Writer) error {
+	steps, err := p.steps(r, rootPath)
+	if err != nil {
+		return err
+	}
+	return pipe(ctx, w, steps...)
+}
+
+func (p PDF) fill(ctx context.Context, r Renderer, rootPath string, w io.Writer) error {
+
+	if p.hasContent() {
+		b, err := p.decodeContent()
+		if err != nil {
+			return err
+		}
+		if len(p.Fields) == 0 && !p.Flatten {
+			_, err = w.Write(b)
+			return err
+		}
+		return fillContent(ctx, r, w, b, p.Fields, p.Flatten)
 	}
 
 	if p.FileName == "" {
-		return nil, errors.New("Invalid filename")
+		return errors.New("Invalid filename")
 	}
 	path := filepath.Join(rootPath, p.FileName)
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		return nil, err
+		return err
 	}
-	tmpfile, err := ioutil.TempFile("", "example")
-	if err != nil {
-		return nil, err
-	}
-	defer os.Remove(tmpfile.Name()) // clean up
-	if _, err := tmpfile.Write(mapToXFDF(p.Fields)); err != nil {
-		return nil, err
-	}
-	if err := tmpfile.Close(); err != nil {
-		return nil, err
-	}
-	cmd := exec.Command("pdftk", path, "fill_form", tmpfile.Name(), "output", "-")
-	logger.Debugf("Executing pdftk %q", strings.Join(cmd.Args, " "))
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	var t bytes.Buffer
-	cmd.Stderr = &t
-	err = cmd.Run()
+	return r.Fill(ctx, w, path, p.Fields, p.Flatten)
+}
+
+// hasContent reports whether p brings its own template rather than naming
+// one in the handler's directory. A downloaded template is content too.
+func (p PDF) hasContent() bool {
+	return p.Content != "" || p.content != nil
+}
+
+// fillContent fills the template b, which the renderer reads from a
+// temporary file.
+func fillContent(ctx context.Context, r Renderer, w io.Writer, b []byte, fields map[string]string, flatten bool) error {
+	f, err := ioutil.TempFile("", "template")
 	if err != nil {
-		return nil, errors.New(t.String())
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
 	}
-	return out.Bytes(), nil
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return r.Fill(ctx, w, f.Name(), fields, flatten)
 }
 
 func (p PDF) decodeContent() ([]byte, error) {
+	if p.content != nil {
+		return p.content, nil
+	}
 	return base64.StdEncoding.DecodeString(p.Content)
 }
@@ -0,0 +1,87 @@
+package pdfhandler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// formPartName matches the document parts of a form upload: template and
+// fields, or template1, fields1, template2 and so on for a batch.
+var formPartName = regexp.MustCompile(`^(template|fields)([0-9]*)$`)
+
+// readForm reads a multipart/form-data POST body. A document is a template
+// file part with an optional fields part holding a json object of field
+// values. An options part holds the request options as json.
+func readForm(r *multipart.Reader) (request, error) {
+	var x request
+	docs := map[string]*PDF{}
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return x, err
+		}
+		name := part.FormName()
+		if name == "options" {
+			if err := json.NewDecoder(part).Decode(&x.Options); err != nil {
+				return x, fmt.Errorf("Invalid form part %q: %s", name, err)
+			}
+			continue
+		}
+		m := formPartName.FindStringSubmatch(name)
+		if m == nil {
+			return x, fmt.Errorf("Unexpected form part %q", name)
+		}
+		p, ok := docs[m[2]]
+		if !ok {
+			p = &PDF{}
+			docs[m[2]] = p
+		}
+		if m[1] == "fields" {
+			if err := json.NewDecoder(part).Decode(&p.Fields); err != nil {
+				return x, fmt.Errorf("Invalid form part %q: %s", name, err)
+			}
+			continue
+		}
+		p.FileName = part.FileName()
+		if p.content, err = ioutil.ReadAll(part); err != nil {
+			return x, err
+		}
+	}
+
+	keys := []string{}
+	for k, p := range docs {
+		if p.content == nil {
+			return x, fmt.Errorf("Form part %q is missing", "template"+k)
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) == 0 {
+		return x, fmt.Errorf("Form part %q is missing", "template")
+	}
+	if _, ok := docs[""]; ok {
+		if len(keys) > 1 {
+			return x, errors.New("Form has both a template part and numbered template parts")
+		}
+		x.PDF = *docs[""]
+		return x, nil
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, _ := strconv.Atoi(keys[i])
+		b, _ := strconv.Atoi(keys[j])
+		return a < b
+	})
+	for _, k := range keys {
+		x.Documents = append(x.Documents, *docs[k])
+	}
+	return x, nil
+}
@@ -0,0 +1,156 @@
+package pdfhandler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type formPart struct {
+	name, filename, body string
+}
+
+func form(t *testing.T, parts ...formPart) (*bytes.Buffer, string) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, p := range parts {
+		var err error
+		if p.filename != "" {
+			f, err := mw.CreateFormFile(p.name, p.filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = f.Write([]byte(p.body))
+		} else {
+			err = mw.WriteField(p.name, p.body)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf, mw.FormDataContentType()
+}
+
+func postForm(t *testing.T, accept string, parts ...formPart) (*http.Response, []byte) {
+	body, ct := form(t, parts...)
+	req, err := http.NewRequest("POST", ts.URL, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("Content-Type", ct)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	out, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, out
+}
+
+func readTemplate(t *testing.T) string {
+	b, err := ioutil.ReadFile("./pdf-test/OoPdfFormExample.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestReadForm(t *testing.T) {
+	body, ct := form(t,
+		formPart{"template10", "ten.pdf", "10"},
+		formPart{"fields2", "", `{"a": "b"}`},
+		formPart{"template2", "two.pdf", "2"},
+		formPart{"options", "", `{"on_error": "lenient"}`},
+	)
+	req, _ := http.NewRequest("POST", "/", body)
+	req.Header.Set("Content-Type", ct)
+	r, err := req.MultipartReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, err := readForm(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "lenient", x.OnError)
+	if !assert.Len(t, x.Documents, 2) {
+		return
+	}
+	assert.Equal(t, "two.pdf", x.Documents[0].FileName)
+	assert.Equal(t, map[string]string{"a": "b"}, x.Documents[0].Fields)
+	assert.Equal(t, []byte("2"), x.Documents[0].content)
+	assert.Equal(t, "ten.pdf", x.Documents[1].FileName)
+}
+
+func TestPostForm(t *testing.T) {
+	SetLogger(&testLogger{t})
+	resp, body := postForm(t, "application/pdf",
+		formPart{"template", "upload.pdf", readTemplate(t)},
+		formPart{"fields", "", `{"Family Name Text Box": "Barsson"}`},
+	)
+	assert.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	assert.True(t, bytes.HasPrefix(body, []byte("%PDF")))
+}
+
+func TestPostFormBatch(t *testing.T) {
+	SetLogger(&testLogger{t})
+	resp, body := postForm(t, "application/zip",
+		formPart{"template1", "first.pdf", readTemplate(t)},
+		formPart{"template2", "second.pdf", readTemplate(t)},
+	)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Got status %d and body %q", resp.StatusCode, body)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"first.pdf", "second.pdf"}, names)
+}
+
+func TestPostInvalidForm(t *testing.T) {
+	SetLogger(&testLogger{t})
+	for _, parts := range [][]formPart{
+		{{"fields", "", `{}`}},
+		{{"template", "a.pdf", "x"}, {"other", "", "y"}},
+		{{"template", "a.pdf", "x"}, {"template1", "b.pdf", "y"}},
+		{{"template", "a.pdf", "x"}, {"fields", "", "not json"}},
+	} {
+		resp, body := postForm(t, "application/pdf", parts...)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, string(body))
+	}
+}
+
+func TestPostFormFill(t *testing.T) {
+	SetLogger(&testLogger{t})
+	resp, body := postForm(t, "application/pdf",
+		formPart{"template", "upload.pdf", readTemplate(t)},
+		formPart{"fields", "", `{"Family Name Text Box": "Barsson"}`},
+		formPart{"options", "", `{"metadata": {"Title": "Uploaded"}}`},
+	)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Got status %d and body %q", resp.StatusCode, body)
+	}
+	d, err := NativeRenderer{}.DocData(context.Background(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Uploaded", d.Info["Title"])
+}
@@ -0,0 +1,362 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// defaultAppearance is the parsed default appearance string of a field.
+type defaultAppearance struct {
+	font  Name
+	size  float64
+	color string
+}
+
+// parseDA reads the font, size and fill color operators of a default
+// appearance string such as "0 0 0 rg /F3 11 Tf".
+func parseDA(s string) defaultAppearance {
+	da := defaultAppearance{color: "0 g"}
+	p := &parser{b: []byte(s)}
+	operands := []Object{}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.b) {
+			break
+		}
+		c := p.b[p.pos]
+		if c == '/' || c == '(' || c == '<' || c == '[' || c == '-' || c == '.' || (c >= '0' && c <= '9') {
+			o, err := p.object()
+			if err != nil {
+				break
+			}
+			operands = append(operands, o)
+			continue
+		}
+		op := p.keyword()
+		if op == "" {
+			p.pos++
+			continue
+		}
+		switch op {
+		case "Tf":
+			if len(operands) >= 2 {
+				da.font, _ = operands[len(operands)-2].(Name)
+				switch v := operands[len(operands)-1].(type) {
+				case int:
+					da.size = float64(v)
+				case float64:
+					da.size = v
+				}
+			}
+		case "g", "rg", "k":
+			parts := []string{}
+			for _, o := range operands {
+				switch v := o.(type) {
+				case int:
+					parts = append(parts, formatReal(float64(v)))
+				case float64:
+					parts = append(parts, formatReal(v))
+				}
+			}
+			da.color = strings.Join(append(parts, op), " ")
+		}
+		operands = operands[:0]
+	}
+	return da
+}
+
+// widgetFont finds the font named by the default appearance in the
+// resources of the widget or the form, falling back to Helvetica when the
+// font is missing or cannot encode text.
+func (d *Document) widgetFont(w Dict, name Name) *font {
+	for _, dr := range []Object{w["DR"], d.AcroForm()["DR"]} {
+		fonts := d.Dict(d.Dict(dr)["Font"])
+		if o, ok := fonts[name]; ok && name != "" {
+			if f := d.loadFont(name, o); f != nil {
+				return f
+			}
+		}
+	}
+	return d.helvetica()
+}
+
+// widgetBox returns the width and height of a widget annotation.
+func (d *Document) widgetBox(w Dict) (float64, float64) {
+	r, _ := d.Rect(w["Rect"])
+	width, height := r[2]-r[0], r[3]-r[1]
+	if mk := d.Dict(w["MK"]); mk != nil {
+		if rot := int(d.Number(mk["R"])); rot == 90 || rot == 270 {
+			return height, width
+		}
+	}
+	return width, height
+}
+
+func colorOp(d *Document, o Object, fill bool) string {
+	c := d.Array(o)
+	parts := make([]string, 0, len(c)+1)
+	for _, v := range c {
+		parts = append(parts, formatReal(d.Number(v)))
+	}
+	op := map[int]string{1: "g", 3: "rg", 4: "k"}[len(c)]
+	if op == "" {
+		return ""
+	}
+	if !fill {
+		op = strings.ToUpper(op)
+	}
+	return strings.Join(append(parts, op), " ")
+}
+
+// frame draws the background and border of a widget as given by its
+// appearance characteristics and returns the border width.
+func (d *Document) frame(buf *bytes.Buffer, w Dict, width, height float64) float64 {
+	mk := d.Dict(w["MK"])
+	if mk == nil {
+		return 0
+	}
+	if bg := colorOp(d, mk["BG"], true); bg != "" {
+		fmt.Fprintf(buf, "%s 0 0 %s %s re f\n", bg, formatReal(width), formatReal(height))
+	}
+	bc := colorOp(d, mk["BC"], false)
+	if bc == "" {
+		return 0
+	}
+	bw := 1.0
+	if bs := d.Dict(w["BS"]); bs != nil {
+		if v, ok := bs["W"]; ok {
+			bw = d.Number(v)
+		}
+	}
+	if bw > 0 {
+		fmt.Fprintf(buf, "%s %s w %s %s %s %s re S\n", bc, formatReal(bw),
+			formatReal(bw/2), formatReal(bw/2), formatReal(width-bw), formatReal(height-bw))
+	}
+	return bw
+}
+
+// setAppearance stores content as the normal appearance of widget w.
+func (d *Document) setAppearance(w Dict, content []byte, width, height float64, fonts Dict) {
+	form := &Stream{
+		Dict: Dict{
+			"Type":      Name("XObject"),
+			"Subtype":   Name("Form"),
+			"BBox":      Array{0, 0, width, height},
+			"Filter":    Name("FlateDecode"),
+			"Resources": Dict{"Font": fonts},
+		},
+		Data: deflate(content),
+	}
+	if mk := d.Dict(w["MK"]); mk != nil {
+		switch int(d.Number(mk["R"])) {
+		case 90:
+			form.Dict["Matrix"] = Array{0, 1, -1, 0, height, 0}
+		case 180:
+			form.Dict["Matrix"] = Array{-1, 0, 0, -1, width, height}
+		case 270:
+			form.Dict["Matrix"] = Array{0, -1, 1, 0, 0, width}
+		}
+	}
+	w["AP"] = Dict{"N": d.Add(form)}
+}
+
+// wrap breaks text into lines no wider than width.
+func wrap(f *font, text string, size, width float64) [][]byte {
+	lines := [][]byte{}
+	for _, para := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		line := []byte{}
+		for _, word := range strings.Fields(para) {
+			w := WinAnsi(word)
+			candidate := w
+			if len(line) > 0 {
+				candidate = append(append(append([]byte{}, line...), ' '), w...)
+			}
+			if len(line) > 0 && f.width(candidate, size) > width {
+				lines = append(lines, line)
+				candidate = w
+			}
+			line = candidate
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// textAppearance generates the appearance of a text or combo box widget
+// showing value.
+func (d *Document) textAppearance(field *Field, w Dict, value string, flags int) error {
+	if w == nil {
+		return nil
+	}
+	da, _ := d.inheritedField(field.Dict, "DA").(String)
+	if s, ok := w["DA"].(String); ok {
+		da = s
+	}
+	a := parseDA(string(da))
+	f := d.widgetFont(w, a.font)
+	width, height := d.widgetBox(w)
+	q := int(d.Number(d.inheritedField(field.Dict, "Q")))
+	if v, ok := w["Q"]; ok {
+		q = int(d.Number(v))
+	}
+
+	var buf bytes.Buffer
+	bw := d.frame(&buf, w, width, height)
+	pad := bw + 1
+	if flags&flagPassword != 0 {
+		value = strings.Repeat("*", len([]rune(value)))
+	}
+	buf.WriteString("/Tx BMC\nq\n")
+	fmt.Fprintf(&buf, "%s %s %s %s re W n\n", formatReal(bw), formatReal(bw), formatReal(width-2*bw), formatReal(height-2*bw))
+	buf.WriteString("BT\n")
+	size := a.size
+	inner := width - 2*pad
+	maxLen := int(d.Number(d.inheritedField(field.Dict, "MaxLen")))
+
+	switch {
+	case flags&flagMultiline != 0:
+		if size <= 0 {
+			size = defaultFontSize
+			for size > 4 && float64(len(wrap(f, value, size, inner)))*size*1.15 > height-2*pad {
+				size--
+			}
+		}
+		fmt.Fprintf(&buf, "/%s %s Tf %s\n", f.name, formatReal(size), a.color)
+		lead := size * 1.15
+		fmt.Fprintf(&buf, "%s TL\n", formatReal(lead))
+		for i, line := range wrap(f, value, size, inner) {
+			x := pad
+			switch q {
+			case 1:
+				x = (width - f.width(line, size)) / 2
+			case 2:
+				x = width - pad - f.width(line, size)
+			}
+			y := height - pad - size*0.9 - float64(i)*lead
+			fmt.Fprintf(&buf, "1 0 0 1 %s %s Tm %s Tj\n", formatReal(x), formatReal(y), formatString(String(line)))
+		}
+	case flags&flagComb != 0 && maxLen > 0:
+		text := WinAnsi(value)
+		if size <= 0 {
+			size = (height - 2*pad) * 0.7
+		}
+		cell := width / float64(maxLen)
+		fmt.Fprintf(&buf, "/%s %s Tf %s\n", f.name, formatReal(size), a.color)
+		y := (height-size*0.925)/2 + size*0.207
+		for i := 0; i < len(text) && i < maxLen; i++ {
+			c := text[i : i+1]
+			x := cell*float64(i) + (cell-f.width(c, size))/2
+			fmt.Fprintf(&buf, "1 0 0 1 %s %s Tm %s Tj\n", formatReal(x), formatReal(y), formatString(String(c)))
+		}
+	default:
+		text := WinAnsi(value)
+		if size <= 0 {
+			size = (height - 2*pad) * 0.7
+			if size > defaultFontSize {
+				size = defaultFontSize
+			}
+			if tw := f.width(text, size); tw > inner && tw > 0 {
+				size *= inner / tw
+			}
+			if size < 4 {
+				size = 4
+			}
+		}
+		tw := f.width(text, size)
+		x := pad
+		switch q {
+		case 1:
+			x = (width - tw) / 2
+		case 2:
+			x = width - pad - tw
+		}
+		y := (height-size*0.925)/2 + size*0.207
+		fmt.Fprintf(&buf, "/%s %s Tf %s\n", f.name, formatReal(size), a.color)
+		fmt.Fprintf(&buf, "%s %s Td %s Tj\n", formatReal(x), formatReal(y), formatString(String(text)))
+	}
+	buf.WriteString("ET\nQ\nEMC\n")
+	d.setAppearance(w, buf.Bytes(), width, height, Dict{f.name: f.ref})
+	return nil
+}
+
+// listAppearance generates the appearance of a list box widget with the
+// option at selected highlighted.
+func (d *Document) listAppearance(field *Field, w Dict, selected int) error {
+	if w == nil {
+		return nil
+	}
+	da, _ := d.inheritedField(field.Dict, "DA").(String)
+	if s, ok := w["DA"].(String); ok {
+		da = s
+	}
+	a := parseDA(string(da))
+	f := d.widgetFont(w, a.font)
+	width, height := d.widgetBox(w)
+	size := a.size
+	if size <= 0 {
+		size = defaultFontSize
+	}
+	lead := size * 1.15
+	top := int(d.Number(field.Dict["TI"]))
+	if selected >= 0 && float64(selected-top+1)*lead > height {
+		top = selected
+	}
+
+	var buf bytes.Buffer
+	bw := d.frame(&buf, w, width, height)
+	pad := bw + 1
+	buf.WriteString("/Tx BMC\nq\n")
+	fmt.Fprintf(&buf, "%s %s %s %s re W n\n", formatReal(bw), formatReal(bw), formatReal(width-2*bw), formatReal(height-2*bw))
+	if selected >= top {
+		y := height - pad - float64(selected-top+1)*lead
+		fmt.Fprintf(&buf, "0.6 0.75 0.86 rg %s %s %s %s re f\n", formatReal(bw), formatReal(y), formatReal(width-2*bw), formatReal(lead))
+	}
+	fmt.Fprintf(&buf, "BT\n/%s %s Tf %s\n", f.name, formatReal(size), a.color)
+	opts, _ := d.inheritedField(field.Dict, "Opt").(Array)
+	for i := top; i < len(opts); i++ {
+		y := height - pad - float64(i-top+1)*lead + (lead-size)/2 + size*0.207
+		if y < -size {
+			break
+		}
+		var text String
+		switch v := d.Resolve(opts[i]).(type) {
+		case String:
+			text = v
+		case Array:
+			if len(v) == 2 {
+				text, _ = d.Resolve(v[1]).(String)
+			}
+		}
+		fmt.Fprintf(&buf, "1 0 0 1 %s %s Tm %s Tj\n", formatReal(pad+1), formatReal(y), formatString(String(WinAnsi(Text(text)))))
+	}
+	buf.WriteString("ET\nQ\nEMC\n")
+	d.setAppearance(w, buf.Bytes(), width, height, Dict{f.name: f.ref})
+	return nil
+}
+
+// checkAppearance generates on and off appearances for a button widget
+// that has none, drawing a check mark for the on state.
+func (d *Document) checkAppearance(w Dict, state Name) {
+	width, height := d.widgetBox(w)
+	size := height * 0.8
+	zapf := d.Add(Dict{"Type": Name("Font"), "Subtype": Name("Type1"), "BaseFont": Name("ZapfDingbats")})
+	on := fmt.Sprintf("q 0 g BT /ZaDb %s Tf %s %s Td (4) Tj ET Q\n",
+		formatReal(size), formatReal((width-size*0.846)/2), formatReal((height-size*0.7)/2))
+	form := func(content string) Ref {
+		return d.Add(&Stream{
+			Dict: Dict{
+				"Type":      Name("XObject"),
+				"Subtype":   Name("Form"),
+				"BBox":      Array{0, 0, width, height},
+				"Resources": Dict{"Font": Dict{"ZaDb": zapf}},
+			},
+			Data: []byte(content),
+		})
+	}
+	n := Dict{"Off": form("")}
+	if state != "Off" {
+		n[state] = form(on)
+	}
+	w["AP"] = Dict{"N": n}
+}
@@ -0,0 +1,236 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PageRef selects a page of a document by its zero based index.
+type PageRef struct {
+	Doc  *Document
+	Page int
+}
+
+// copier copies objects from one document into another, allocating new
+// object numbers. Pages that were not selected for copying, and the page
+// tree itself, are replaced by null so that copying a page does not drag
+// in the rest of its document.
+type copier struct {
+	src, dst *Document
+	mapped   map[int]Ref
+}
+
+func newCopier(src, dst *Document) *copier {
+	return &copier{src: src, dst: dst, mapped: map[int]Ref{}}
+}
+
+func (c *copier) copy(o Object) Object {
+	switch v := o.(type) {
+	case Ref:
+		if r, ok := c.mapped[v.Num]; ok {
+			return r
+		}
+		obj := c.src.Get(v.Num)
+		if d, ok := obj.(Dict); ok {
+			switch d.Name("Type") {
+			case "Page", "Pages":
+				return nil
+			}
+		}
+		r := c.dst.Add(nil)
+		c.mapped[v.Num] = r
+		c.dst.Set(r, c.copy(obj))
+		return r
+	case Dict:
+		d := make(Dict, len(v))
+		for k, e := range v {
+			if e := c.copy(e); e != nil {
+				d[k] = e
+			}
+		}
+		return d
+	case Array:
+		a := make(Array, len(v))
+		for i, e := range v {
+			a[i] = c.copy(e)
+		}
+		return a
+	case *Stream:
+		return &Stream{Dict: c.copy(v.Dict).(Dict), Data: v.Data}
+	}
+	return o
+}
+
+// inheritable lists the page attributes that may be inherited from the
+// page tree.
+var inheritable = []Name{"Resources", "MediaBox", "CropBox", "Rotate"}
+
+// Assemble builds a new document out of the selected pages, in order. A
+// page may be selected more than once. Form fields on the selected pages
+// are carried over, fields of later documents are renamed if their names
+// clash with fields already copied.
+func Assemble(pages []PageRef) (*Document, error) {
+	if len(pages) == 0 {
+		return nil, errors.New("pdf: no pages selected")
+	}
+	dst := New()
+	root := dst.Catalog()
+	tree := dst.Dict(root["Pages"])
+
+	type occurrence struct {
+		doc *Document
+		n   int
+	}
+	copiers := map[occurrence]*copier{}
+	order := []*copier{}
+	seen := map[PageRef]int{}
+	type selection struct {
+		c   *copier
+		src Ref
+		dst Ref
+	}
+	sel := make([]selection, len(pages))
+	srcPages := map[*Document][]Ref{}
+	for i, p := range pages {
+		refs, ok := srcPages[p.Doc]
+		if !ok {
+			refs = p.Doc.Pages()
+			srcPages[p.Doc] = refs
+		}
+		if p.Page < 0 || p.Page >= len(refs) {
+			return nil, fmt.Errorf("pdf: page %d out of range", p.Page+1)
+		}
+		key := occurrence{p.Doc, seen[p]}
+		seen[p]++
+		c, ok := copiers[key]
+		if !ok {
+			c = newCopier(p.Doc, dst)
+			copiers[key] = c
+			order = append(order, c)
+		}
+		src := refs[p.Page]
+		r := dst.Add(nil)
+		c.mapped[src.Num] = r
+		sel[i] = selection{c, src, r}
+	}
+
+	kids := Array{}
+	for _, s := range sel {
+		src := s.c.src.Dict(s.src)
+		page := Dict{}
+		for k, v := range src {
+			if k == "Parent" {
+				continue
+			}
+			if v := s.c.copy(v); v != nil {
+				page[k] = v
+			}
+		}
+		for _, k := range inheritable {
+			if _, ok := page[k]; !ok {
+				if v := s.c.src.Inherited(src, k); v != nil {
+					page[k] = s.c.copy(v)
+				}
+			}
+		}
+		page["Type"] = Name("Page")
+		page["Parent"] = root["Pages"]
+		dst.Set(s.dst, page)
+		kids = append(kids, s.dst)
+	}
+	tree["Kids"] = kids
+	tree["Count"] = len(kids)
+
+	mergeForms(dst, order)
+	first := pages[0].Doc
+	if info := first.Info(false); info != nil {
+		dst.Trailer["Info"] = dst.Add(newCopier(first, dst).copy(info))
+	}
+	for _, c := range order {
+		if c.src.Version > dst.Version {
+			dst.Version = c.src.Version
+		}
+	}
+	return dst, nil
+}
+
+// mergeForms builds the form of dst out of the fields copied by each
+// copier.
+func mergeForms(dst *Document, copiers []*copier) {
+	fields := Array{}
+	names := map[string]bool{}
+	var form Dict
+	for i, c := range copiers {
+		src := c.src.AcroForm()
+		if src == nil {
+			continue
+		}
+		roots := Array{}
+		clash := false
+		for _, f := range c.src.Array(src["Fields"]) {
+			r, ok := f.(Ref)
+			if !ok {
+				continue
+			}
+			if m, ok := c.mapped[r.Num]; ok {
+				roots = append(roots, m)
+				if t, ok := dst.Resolve(dst.Dict(m)["T"]).(String); ok && names[Text(t)] {
+					clash = true
+				}
+			}
+		}
+		if len(roots) == 0 {
+			continue
+		}
+		if clash {
+			name := fmt.Sprintf("%d", i+1)
+			for n := i + 1; names[name]; n++ {
+				name = fmt.Sprintf("%d_%d", i+1, n)
+			}
+			parent := dst.Add(Dict{"T": TextString(name), "Kids": roots})
+			for _, r := range roots {
+				dst.Dict(r)["Parent"] = parent
+			}
+			roots = Array{parent}
+		}
+		for _, r := range roots {
+			if t, ok := dst.Resolve(dst.Dict(r)["T"]).(String); ok {
+				names[Text(t)] = true
+			}
+		}
+		fields = append(fields, roots...)
+
+		if form == nil {
+			form = Dict{}
+			for _, k := range []Name{"DA", "Q", "NeedAppearances"} {
+				if v, ok := src[k]; ok {
+					form[k] = c.copy(v)
+				}
+			}
+			form["DR"] = Dict{}
+		}
+		// Merge the default resources, keeping the first definition of
+		// each name.
+		dr := form["DR"].(Dict)
+		for k, v := range c.src.Dict(src["DR"]) {
+			sub := c.src.Dict(v)
+			if sub == nil {
+				continue
+			}
+			merged, ok := dr[k].(Dict)
+			if !ok {
+				merged = Dict{}
+				dr[k] = merged
+			}
+			for name, e := range sub {
+				if _, ok := merged[name]; !ok {
+					merged[name] = c.copy(e)
+				}
+			}
+		}
+	}
+	if form != nil {
+		form["Fields"] = fields
+		dst.Catalog()["AcroForm"] = dst.Add(form)
+	}
+}
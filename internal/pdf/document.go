@@ -0,0 +1,657 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ErrEncrypted is returned by Open for encrypted documents.
+var ErrEncrypted = errors.New("pdf: encrypted documents are not supported")
+
+// Document is a pdf file held in memory. Objects are addressed by their
+// object number, generation numbers are dropped when a file is read and
+// written as zero.
+type Document struct {
+	Version string
+	Trailer Dict
+	objects map[int]Object
+	next    int
+	helv    *font
+}
+
+// New returns an empty document with a catalog and an empty page tree.
+func New() *Document {
+	d := &Document{Version: "1.4", objects: map[int]Object{}, next: 1}
+	pages := d.Add(Dict{"Type": Name("Pages"), "Kids": Array{}, "Count": 0})
+	d.Trailer = Dict{"Root": d.Add(Dict{"Type": Name("Catalog"), "Pages": pages})}
+	return d
+}
+
+// Get returns object num, or nil if there is no such object.
+func (d *Document) Get(num int) Object {
+	return d.objects[num]
+}
+
+// Set replaces the object referenced by r.
+func (d *Document) Set(r Ref, o Object) {
+	d.objects[r.Num] = o
+	if r.Num >= d.next {
+		d.next = r.Num + 1
+	}
+}
+
+// Add stores o as a new indirect object and returns a reference to it.
+func (d *Document) Add(o Object) Ref {
+	r := Ref{Num: d.next}
+	d.objects[r.Num] = o
+	d.next++
+	return r
+}
+
+// Resolve follows references until it reaches a direct object.
+func (d *Document) Resolve(o Object) Object {
+	for i := 0; i < 32; i++ {
+		r, ok := o.(Ref)
+		if !ok {
+			return o
+		}
+		o = d.objects[r.Num]
+	}
+	return nil
+}
+
+// Dict resolves o and returns it if it is a dictionary or the dictionary
+// of a stream.
+func (d *Document) Dict(o Object) Dict {
+	switch v := d.Resolve(o).(type) {
+	case Dict:
+		return v
+	case *Stream:
+		return v.Dict
+	}
+	return nil
+}
+
+// Array resolves o and returns it if it is an array.
+func (d *Document) Array(o Object) Array {
+	a, _ := d.Resolve(o).(Array)
+	return a
+}
+
+// Number resolves o and returns it as a float.
+func (d *Document) Number(o Object) float64 {
+	switch v := d.Resolve(o).(type) {
+	case int:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
+
+// Catalog returns the document catalog.
+func (d *Document) Catalog() Dict {
+	return d.Dict(d.Trailer["Root"])
+}
+
+// Info returns the document information dictionary, creating it if
+// create is set and the document has none.
+func (d *Document) Info(create bool) Dict {
+	info := d.Dict(d.Trailer["Info"])
+	if info == nil && create {
+		info = Dict{}
+		d.Trailer["Info"] = d.Add(info)
+	}
+	return info
+}
+
+// Pages returns references to the pages of the document in order.
+func (d *Document) Pages() []Ref {
+	pages := []Ref{}
+	seen := map[int]bool{}
+	var walk func(o Object)
+	walk = func(o Object) {
+		r, ok := o.(Ref)
+		if !ok || seen[r.Num] {
+			return
+		}
+		seen[r.Num] = true
+		node := d.Dict(r)
+		if node == nil {
+			return
+		}
+		if kids, ok := d.Resolve(node["Kids"]).(Array); ok && node.Name("Type") != "Page" {
+			for _, k := range kids {
+				walk(k)
+			}
+			return
+		}
+		pages = append(pages, r)
+	}
+	walk(d.Catalog()["Pages"])
+	return pages
+}
+
+// Inherited looks up key on page or the nearest ancestor in the page tree
+// defining it.
+func (d *Document) Inherited(page Dict, key Name) Object {
+	for i := 0; page != nil && i < 64; i++ {
+		if v, ok := page[key]; ok {
+			return v
+		}
+		page = d.Dict(page["Parent"])
+	}
+	return nil
+}
+
+// Rect resolves o as a normalized rectangle.
+func (d *Document) Rect(o Object) (r [4]float64, ok bool) {
+	a := d.Array(o)
+	if len(a) != 4 {
+		return r, false
+	}
+	for i := range r {
+		r[i] = d.Number(a[i])
+	}
+	if r[0] > r[2] {
+		r[0], r[2] = r[2], r[0]
+	}
+	if r[1] > r[3] {
+		r[1], r[3] = r[3], r[1]
+	}
+	return r, true
+}
+
+// MediaBox returns the media box of page, defaulting to US letter.
+func (d *Document) MediaBox(page Dict) [4]float64 {
+	if r, ok := d.Rect(d.Inherited(page, "MediaBox")); ok {
+		return r
+	}
+	return [4]float64{0, 0, 612, 792}
+}
+
+// Rotation returns the rotation of page in degrees.
+func (d *Document) Rotation(page Dict) int {
+	r := int(d.Number(d.Inherited(page, "Rotate"))) % 360
+	if r < 0 {
+		r += 360
+	}
+	return r
+}
+
+type xrefEntry struct {
+	offset int
+	stream int // object stream holding the object, if > 0
+	index  int
+	free   bool
+}
+
+type reader struct {
+	doc     *Document
+	data    []byte
+	entries map[int]xrefEntry
+	loading map[int]bool
+	objstms map[int]map[int]Object
+}
+
+// Open parses a pdf file.
+func Open(b []byte) (*Document, error) {
+	d := &Document{Version: "1.4", objects: map[int]Object{}}
+	if i := bytes.Index(b, []byte("%PDF-")); i >= 0 && i+8 <= len(b) {
+		d.Version = string(b[i+5 : i+8])
+	}
+	r := &reader{doc: d, data: b}
+	if err := r.readXref(); err != nil {
+		if err := r.reconstruct(); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := d.Trailer["Encrypt"]; ok {
+		return nil, ErrEncrypted
+	}
+	if err := r.loadAll(); err != nil {
+		if err := r.reconstruct(); err != nil {
+			return nil, err
+		}
+		if err := r.loadAll(); err != nil {
+			return nil, err
+		}
+	}
+	for n := range d.objects {
+		if n >= d.next {
+			d.next = n + 1
+		}
+	}
+	if d.Catalog() == nil {
+		return nil, errors.New("pdf: missing document catalog")
+	}
+	return d, nil
+}
+
+func (r *reader) loadAll() error {
+	r.doc.objects = map[int]Object{}
+	r.loading = map[int]bool{}
+	r.objstms = map[int]map[int]Object{}
+	for n, e := range r.entries {
+		if e.free {
+			continue
+		}
+		if _, err := r.load(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load returns object num, reading it from the file if needed.
+func (r *reader) load(num int) (Object, error) {
+	if o, ok := r.doc.objects[num]; ok {
+		return o, nil
+	}
+	e, ok := r.entries[num]
+	if !ok || e.free {
+		return nil, nil
+	}
+	if r.loading[num] {
+		return nil, fmt.Errorf("pdf: object %d refers to itself", num)
+	}
+	r.loading[num] = true
+	defer delete(r.loading, num)
+
+	var o Object
+	if e.stream > 0 {
+		objs, err := r.objectStream(e.stream)
+		if err != nil {
+			return nil, err
+		}
+		o = objs[num]
+	} else {
+		n, obj, _, err := r.readAt(e.offset)
+		if err != nil {
+			return nil, err
+		}
+		if n != num {
+			return nil, fmt.Errorf("pdf: expected object %d at offset %d, found %d", num, e.offset, n)
+		}
+		o = obj
+	}
+	r.doc.objects[num] = o
+	return o, nil
+}
+
+// readAt parses the indirect object starting at off and returns its
+// number, the object and the offset following it.
+func (r *reader) readAt(off int) (int, Object, int, error) {
+	if off < 0 || off >= len(r.data) {
+		return 0, nil, 0, fmt.Errorf("pdf: offset %d out of range", off)
+	}
+	p := &parser{b: r.data, pos: off}
+	num, err := p.integer()
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	if _, err := p.integer(); err != nil {
+		return 0, nil, 0, err
+	}
+	if err := p.expect("obj"); err != nil {
+		return 0, nil, 0, err
+	}
+	o, err := p.object()
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	if dict, ok := o.(Dict); ok && p.streamStart() {
+		s := &Stream{Dict: dict}
+		s.Data, p.pos = r.streamData(dict, p.pos)
+		o = s
+	}
+	save := p.pos
+	if p.keyword() != "endobj" {
+		p.pos = save
+	}
+	return num, o, p.pos, nil
+}
+
+var endstream = []byte("endstream")
+
+// streamData returns the data of a stream starting at start and the
+// offset following the endstream keyword.
+func (r *reader) streamData(dict Dict, start int) ([]byte, int) {
+	length := -1
+	switch v := dict["Length"].(type) {
+	case int:
+		length = v
+	case Ref:
+		if r.entries != nil {
+			if o, err := r.load(v.Num); err == nil {
+				if n, ok := o.(int); ok {
+					length = n
+				}
+			}
+		}
+	}
+	if length >= 0 && start+length <= len(r.data) {
+		p := &parser{b: r.data, pos: start + length}
+		if p.keyword() == "endstream" {
+			return r.data[start : start+length], p.pos
+		}
+	}
+	// Fall back to searching for the end of the stream.
+	i := bytes.Index(r.data[start:], endstream)
+	if i < 0 {
+		return r.data[start:], len(r.data)
+	}
+	data := r.data[start : start+i]
+	if n := len(data); n > 0 && data[n-1] == '\n' {
+		data = data[:n-1]
+		if n := len(data); n > 0 && data[n-1] == '\r' {
+			data = data[:n-1]
+		}
+	} else if n > 0 && data[n-1] == '\r' {
+		data = data[:n-1]
+	}
+	return data, start + i + len(endstream)
+}
+
+func (r *reader) objectStream(num int) (map[int]Object, error) {
+	if objs, ok := r.objstms[num]; ok {
+		return objs, nil
+	}
+	o, err := r.load(num)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := o.(*Stream)
+	if !ok {
+		return nil, fmt.Errorf("pdf: object %d is not an object stream", num)
+	}
+	b, err := r.doc.Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	n, first := s.Dict.Int("N"), s.Dict.Int("First")
+	p := &parser{b: b}
+	objs := map[int]Object{}
+	header := make([][2]int, 0, n)
+	for i := 0; i < n; i++ {
+		num, err := p.integer()
+		if err != nil {
+			return nil, err
+		}
+		off, err := p.integer()
+		if err != nil {
+			return nil, err
+		}
+		header = append(header, [2]int{num, off})
+	}
+	for _, h := range header {
+		p.pos = first + h[1]
+		o, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		objs[h[0]] = o
+	}
+	r.objstms[num] = objs
+	return objs, nil
+}
+
+func (r *reader) startxref() (int, error) {
+	tail := len(r.data) - 2048
+	if tail < 0 {
+		tail = 0
+	}
+	i := bytes.LastIndex(r.data[tail:], []byte("startxref"))
+	if i < 0 {
+		return 0, errors.New("pdf: missing startxref")
+	}
+	p := &parser{b: r.data, pos: tail + i + len("startxref")}
+	return p.integer()
+}
+
+func (r *reader) readXref() error {
+	off, err := r.startxref()
+	if err != nil {
+		return err
+	}
+	r.entries = map[int]xrefEntry{}
+	r.doc.Trailer = nil
+	seen := map[int]bool{}
+	for off > 0 && !seen[off] {
+		seen[off] = true
+		trailer, err := r.readXrefSection(off)
+		if err != nil {
+			return err
+		}
+		if stm, ok := trailer["XRefStm"].(int); ok && !seen[stm] {
+			seen[stm] = true
+			if _, err := r.readXrefSection(stm); err != nil {
+				return err
+			}
+		}
+		if r.doc.Trailer == nil {
+			r.doc.Trailer = trailer
+		} else {
+			for k, v := range trailer {
+				if _, ok := r.doc.Trailer[k]; !ok {
+					r.doc.Trailer[k] = v
+				}
+			}
+		}
+		off, _ = trailer["Prev"].(int)
+	}
+	if r.doc.Trailer == nil {
+		return errors.New("pdf: missing trailer")
+	}
+	return nil
+}
+
+func (r *reader) addEntry(num int, e xrefEntry) {
+	if _, ok := r.entries[num]; !ok && num > 0 {
+		r.entries[num] = e
+	}
+}
+
+// readXrefSection reads an xref table or stream at off and returns its
+// trailer dictionary.
+func (r *reader) readXrefSection(off int) (Dict, error) {
+	p := &parser{b: r.data, pos: off}
+	if off >= len(r.data) {
+		return nil, fmt.Errorf("pdf: xref offset %d out of range", off)
+	}
+	if p.keyword() != "xref" {
+		return r.readXrefStream(off)
+	}
+	for {
+		save := p.pos
+		k := p.keyword()
+		if k == "trailer" {
+			break
+		}
+		p.pos = save
+		start, err := p.integer()
+		if err != nil {
+			return nil, err
+		}
+		count, err := p.integer()
+		if err != nil {
+			return nil, err
+		}
+		for i := 0; i < count; i++ {
+			offset, err := p.integer()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.integer(); err != nil {
+				return nil, err
+			}
+			switch p.keyword() {
+			case "n":
+				r.addEntry(start+i, xrefEntry{offset: offset})
+			case "f":
+				r.addEntry(start+i, xrefEntry{free: true})
+			default:
+				return nil, p.errorf("invalid xref entry")
+			}
+		}
+	}
+	o, err := p.object()
+	if err != nil {
+		return nil, err
+	}
+	trailer, ok := o.(Dict)
+	if !ok {
+		return nil, p.errorf("invalid trailer")
+	}
+	return trailer, nil
+}
+
+func (r *reader) readXrefStream(off int) (Dict, error) {
+	_, o, _, err := r.readAt(off)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := o.(*Stream)
+	if !ok || s.Dict.Name("Type") != "XRef" {
+		return nil, fmt.Errorf("pdf: no xref at offset %d", off)
+	}
+	b, err := r.doc.Decode(s)
+	if err != nil {
+		return nil, err
+	}
+	w, _ := s.Dict["W"].(Array)
+	if len(w) != 3 {
+		return nil, errors.New("pdf: invalid xref stream")
+	}
+	var widths [3]int
+	total := 0
+	for i := range widths {
+		widths[i], _ = w[i].(int)
+		total += widths[i]
+	}
+	index, _ := s.Dict["Index"].(Array)
+	if index == nil {
+		index = Array{0, s.Dict.Int("Size")}
+	}
+	field := func(b []byte, def int) int {
+		if len(b) == 0 {
+			return def
+		}
+		v := 0
+		for _, c := range b {
+			v = v<<8 | int(c)
+		}
+		return v
+	}
+	for i := 0; i+1 < len(index) && total > 0; i += 2 {
+		start, _ := index[i].(int)
+		count, _ := index[i+1].(int)
+		for j := 0; j < count && len(b) >= total; j++ {
+			typ := field(b[:widths[0]], 1)
+			f2 := field(b[widths[0]:widths[0]+widths[1]], 0)
+			f3 := field(b[widths[0]+widths[1]:total], 0)
+			b = b[total:]
+			switch typ {
+			case 0:
+				r.addEntry(start+j, xrefEntry{free: true})
+			case 1:
+				r.addEntry(start+j, xrefEntry{offset: f2})
+			case 2:
+				r.addEntry(start+j, xrefEntry{stream: f2, index: f3})
+			}
+		}
+	}
+	trailer := Dict{}
+	for k, v := range s.Dict {
+		trailer[k] = v
+	}
+	return trailer, nil
+}
+
+var objHeader = regexp.MustCompile(`(\d+)[\x00\t\n\f\r ]+(\d+)[\x00\t\n\f\r ]+obj\b`)
+
+// reconstruct rebuilds the cross reference table by scanning the file for
+// objects, for documents with a missing or damaged xref.
+func (r *reader) reconstruct() error {
+	r.entries = nil
+	found := map[int]xrefEntry{}
+	end := 0
+	var trailer Dict
+	for _, m := range objHeader.FindAllSubmatchIndex(r.data, -1) {
+		if m[0] < end {
+			continue
+		}
+		if m[0] > 0 && isRegular(r.data[m[0]-1]) {
+			continue
+		}
+		num, obj, next, err := r.readAt(m[0])
+		if err != nil {
+			continue
+		}
+		found[num] = xrefEntry{offset: m[0]}
+		end = next
+		if s, ok := obj.(*Stream); ok && s.Dict.Name("Type") == "XRef" {
+			trailer = s.Dict
+		}
+	}
+	if len(found) == 0 {
+		return errors.New("pdf: no objects found")
+	}
+	r.entries = found
+	if i := bytes.LastIndex(r.data, []byte("trailer")); i >= 0 {
+		p := &parser{b: r.data, pos: i + len("trailer")}
+		if o, err := p.object(); err == nil {
+			if d, ok := o.(Dict); ok {
+				trailer = d
+			}
+		}
+	}
+	if trailer == nil {
+		trailer = Dict{}
+	}
+	r.doc.Trailer = Dict{}
+	for _, k := range []Name{"Root", "Info", "ID", "Encrypt"} {
+		if v, ok := trailer[k]; ok {
+			r.doc.Trailer[k] = v
+		}
+	}
+	// Objects compressed in object streams are only listed by xref
+	// streams, so add them from the object streams themselves.
+	r.loading = map[int]bool{}
+	r.objstms = map[int]map[int]Object{}
+	r.doc.objects = map[int]Object{}
+	nums := make([]int, 0, len(found))
+	for n := range found {
+		nums = append(nums, n)
+	}
+	for _, n := range nums {
+		o, err := r.load(n)
+		if err != nil {
+			continue
+		}
+		if s, ok := o.(*Stream); ok && s.Dict.Name("Type") == "ObjStm" {
+			objs, err := r.objectStream(n)
+			if err != nil {
+				continue
+			}
+			for num := range objs {
+				if _, ok := r.entries[num]; !ok {
+					r.entries[num] = xrefEntry{stream: n}
+				}
+			}
+		}
+	}
+	if _, ok := r.doc.Trailer["Root"]; !ok {
+		for n := range r.entries {
+			if o, err := r.load(n); err == nil {
+				if d, ok := o.(Dict); ok && d.Name("Type") == "Catalog" {
+					r.doc.Trailer["Root"] = Ref{Num: n}
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package pdf
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func openTestForm(t *testing.T) *Document {
+	b, err := ioutil.ReadFile("../../pdf-test/OoPdfFormExample.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Open(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestOpen(t *testing.T) {
+	d := openTestForm(t)
+	if d.Version != "1.4" {
+		t.Fatalf("Got version %q", d.Version)
+	}
+	pages := d.Pages()
+	if len(pages) != 1 {
+		t.Fatalf("Expected one page, got %d", len(pages))
+	}
+	if box := d.MediaBox(d.Dict(pages[0])); box != [4]float64{0, 0, 595, 842} {
+		t.Fatalf("Got media box %v", box)
+	}
+	if title := Text(d.Info(false)["Title"].(String)); title != "PDF Form Example" {
+		t.Fatalf("Got title %q", title)
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	b, err := openTestForm(t).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := Open(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Pages()) != 1 {
+		t.Fatal("Expected the page to survive a round trip")
+	}
+	s, ok := d.Resolve(d.Dict(d.Pages()[0])["Contents"]).(*Stream)
+	if !ok {
+		t.Fatal("Expected a content stream")
+	}
+	if _, err := d.Decode(s); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutlineRoundTrip(t *testing.T) {
+	d := openTestForm(t)
+	bookmarks := []Bookmark{{"Bundle", 1, 0}, {"Förm", 2, 0}, {"Missing", 2, -1}, {"Last", 1, 0}}
+	d.SetOutline(bookmarks)
+	b, err := d.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err = Open(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := d.Outline(); !reflect.DeepEqual(out, bookmarks) {
+		t.Fatalf("Expected %v, got %v", bookmarks, out)
+	}
+}
+
+func TestReconstruct(t *testing.T) {
+	b, err := openTestForm(t).Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Corrupt the startxref offset.
+	for i := len(b) - 20; i < len(b)-6; i++ {
+		if b[i] >= '0' && b[i] <= '9' {
+			b[i] = '1'
+		}
+	}
+	d, err := Open(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Pages()) != 1 {
+		t.Fatal("Expected the page to be recovered")
+	}
+}
+
+func TestParseObjects(t *testing.T) {
+	p := &parser{b: []byte(`<</A 1 0 R/B [1 2.5 -3 (a\(b\)\101) <48 49>] /C#20D true /E null>>`)}
+	o, err := p.object()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := o.(Dict)
+	if d["A"] != (Ref{1, 0}) {
+		t.Fatalf("Got %v", d["A"])
+	}
+	a := d["B"].(Array)
+	if a[0] != 1 || a[1] != 2.5 || a[2] != -3 || string(a[3].(String)) != "a(b)A" || string(a[4].(String)) != "HI" {
+		t.Fatalf("Got %v", a)
+	}
+	if d["C D"] != true {
+		t.Fatalf("Got %v", d)
+	}
+	if _, ok := d["E"]; ok {
+		t.Fatal("Expected null entries to be dropped")
+	}
+}
+
+func TestText(t *testing.T) {
+	for _, s := range []string{"Barsson", "Þórsson", ""} {
+		if out := Text(TextString(s)); out != s {
+			t.Fatalf("Expected %q, got %q", s, out)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Decode returns the data of s with its filters removed. Only FlateDecode,
+// with or without PNG predictors, is supported.
+func (d *Document) Decode(s *Stream) ([]byte, error) {
+	filters := d.Resolve(s.Dict["Filter"])
+	parms := d.Resolve(s.Dict["DecodeParms"])
+	var fs, ps Array
+	switch f := filters.(type) {
+	case nil:
+		return s.Data, nil
+	case Name:
+		fs, ps = Array{f}, Array{parms}
+	case Array:
+		fs = f
+		ps, _ = parms.(Array)
+	default:
+		return nil, fmt.Errorf("pdf: invalid filter %v", filters)
+	}
+	b := s.Data
+	for i, f := range fs {
+		var parm Dict
+		if i < len(ps) {
+			parm, _ = d.Resolve(ps[i]).(Dict)
+		}
+		var err error
+		switch d.Resolve(f) {
+		case Name("FlateDecode"), Name("Fl"):
+			b, err = inflate(b)
+			if err == nil && parm != nil {
+				b, err = unpredict(b, parm)
+			}
+		default:
+			err = fmt.Errorf("pdf: unsupported filter %v", f)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func inflate(b []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	out, err := ioutil.ReadAll(r)
+	if err == io.ErrUnexpectedEOF && len(out) > 0 {
+		// Truncated streams are common, keep what could be read.
+		err = nil
+	}
+	return out, err
+}
+
+func deflate(b []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+// unpredict reverses the PNG predictors used by xref and object streams.
+func unpredict(b []byte, parm Dict) ([]byte, error) {
+	predictor := parm.Int("Predictor")
+	if predictor <= 1 {
+		return b, nil
+	}
+	if predictor < 10 {
+		return nil, fmt.Errorf("pdf: unsupported predictor %d", predictor)
+	}
+	colors, bpc, columns := parm.Int("Colors"), parm.Int("BitsPerComponent"), parm.Int("Columns")
+	if colors == 0 {
+		colors = 1
+	}
+	if bpc == 0 {
+		bpc = 8
+	}
+	if columns == 0 {
+		columns = 1
+	}
+	bpp := (colors*bpc + 7) / 8
+	row := (colors*bpc*columns + 7) / 8
+	out := make([]byte, 0, len(b))
+	prev := make([]byte, row)
+	for len(b) > row {
+		ft, cur := b[0], append([]byte(nil), b[1:row+1]...)
+		b = b[row+1:]
+		for i := range cur {
+			var left, upleft byte
+			if i >= bpp {
+				left, upleft = cur[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch ft {
+			case 1:
+				cur[i] += left
+			case 2:
+				cur[i] += up
+			case 3:
+				cur[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				cur[i] += paeth(left, up, upleft)
+			}
+		}
+		out = append(out, cur...)
+		prev = cur
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,153 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
+
+// normalAppearance returns the normal appearance stream of an annotation,
+// picking the current state for appearances with several states.
+func (d *Document) normalAppearance(a Dict) (Ref, *Stream) {
+	ap := d.Dict(a["AP"])
+	if ap == nil {
+		return Ref{}, nil
+	}
+	n := ap["N"]
+	if states, ok := d.Resolve(n).(Dict); ok {
+		as, _ := d.Resolve(a["AS"]).(Name)
+		n = states[as]
+	}
+	r, ok := n.(Ref)
+	if !ok {
+		return Ref{}, nil
+	}
+	s, _ := d.Resolve(r).(*Stream)
+	return r, s
+}
+
+// placement returns the matrix that maps the bounding box of the form
+// appearance s onto rect, as described in section 12.5.5 of the pdf
+// specification.
+func (d *Document) placement(s *Stream, rect [4]float64) ([6]float64, bool) {
+	bbox, ok := d.Rect(s.Dict["BBox"])
+	if !ok {
+		return [6]float64{}, false
+	}
+	m := [6]float64{1, 0, 0, 1, 0, 0}
+	if a := d.Array(s.Dict["Matrix"]); len(a) == 6 {
+		for i := range m {
+			m[i] = d.Number(a[i])
+		}
+	}
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range [][2]float64{{bbox[0], bbox[1]}, {bbox[2], bbox[1]}, {bbox[0], bbox[3]}, {bbox[2], bbox[3]}} {
+		x := m[0]*p[0] + m[2]*p[1] + m[4]
+		y := m[1]*p[0] + m[3]*p[1] + m[5]
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+	if maxX-minX == 0 || maxY-minY == 0 {
+		return [6]float64{}, false
+	}
+	sx := (rect[2] - rect[0]) / (maxX - minX)
+	sy := (rect[3] - rect[1]) / (maxY - minY)
+	return [6]float64{sx, 0, 0, sy, rect[0] - minX*sx, rect[1] - minY*sy}, true
+}
+
+// pageResources returns the resources dictionary of page, made direct on
+// the page so that changes do not leak into other pages sharing it.
+func (d *Document) pageResources(page Dict) Dict {
+	res := Dict{}
+	for k, v := range d.Dict(d.Inherited(page, "Resources")) {
+		res[k] = v
+	}
+	page["Resources"] = res
+	return res
+}
+
+// addXObject registers o under a new name in the XObject resources of
+// page and returns the name.
+func (d *Document) addXObject(page Dict, prefix string, o Ref) Name {
+	res := d.pageResources(page)
+	xobjects := Dict{}
+	for k, v := range d.Dict(res["XObject"]) {
+		xobjects[k] = v
+	}
+	res["XObject"] = xobjects
+	for i := 0; ; i++ {
+		name := Name(fmt.Sprintf("%s%d", prefix, i))
+		if _, ok := xobjects[name]; !ok {
+			xobjects[name] = o
+			return name
+		}
+	}
+}
+
+// appendContent adds content on top of the existing content of page,
+// isolating the existing content's graphics state.
+func (d *Document) appendContent(page Dict, content []byte) {
+	contents := Array{d.Add(&Stream{Dict: Dict{}, Data: []byte("q\n")})}
+	switch c := page["Contents"].(type) {
+	case Ref:
+		if a, ok := d.Resolve(c).(Array); ok {
+			contents = append(contents, a...)
+		} else {
+			contents = append(contents, c)
+		}
+	case Array:
+		contents = append(contents, c...)
+	}
+	contents = append(contents, d.Add(&Stream{
+		Dict: Dict{"Filter": Name("FlateDecode")},
+		Data: deflate(append([]byte("\nQ\n"), content...)),
+	}))
+	page["Contents"] = contents
+}
+
+// Flatten draws the appearance of every form field into the content of
+// its page and removes the interactive form.
+func (d *Document) Flatten() error {
+	for _, pr := range d.Pages() {
+		page := d.Dict(pr)
+		annots := d.Array(page["Annots"])
+		if annots == nil {
+			continue
+		}
+		keep := Array{}
+		var content bytes.Buffer
+		for _, ar := range annots {
+			a := d.Dict(ar)
+			if a == nil || a.Name("Subtype") != "Widget" {
+				keep = append(keep, ar)
+				continue
+			}
+			if int(d.Number(a["F"]))&annotHidden != 0 {
+				continue
+			}
+			r, s := d.normalAppearance(a)
+			rect, ok := d.Rect(a["Rect"])
+			if s == nil || !ok {
+				continue
+			}
+			m, ok := d.placement(s, rect)
+			if !ok {
+				continue
+			}
+			name := d.addXObject(page, "Fl", r)
+			fmt.Fprintf(&content, "q %s %s %s %s %s %s cm %s Do Q\n",
+				formatReal(m[0]), formatReal(m[1]), formatReal(m[2]), formatReal(m[3]), formatReal(m[4]), formatReal(m[5]), formatName(name))
+		}
+		if len(keep) > 0 {
+			page["Annots"] = keep
+		} else {
+			delete(page, "Annots")
+		}
+		if content.Len() > 0 {
+			d.appendContent(page, content.Bytes())
+		}
+	}
+	delete(d.Catalog(), "AcroForm")
+	return nil
+}
@@ -0,0 +1,147 @@
+package pdf
+
+// helveticaWidths holds the glyph widths of Helvetica for the printable
+// ASCII range, starting at the space character.
+var helveticaWidths = [...]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// HelveticaWidth returns the width of the WinAnsi encoded character c in
+// Helvetica, in thousandths of the font size.
+func HelveticaWidth(c byte) int {
+	if c >= 32 && int(c-32) < len(helveticaWidths) {
+		return helveticaWidths[c-32]
+	}
+	return 556
+}
+
+// HelveticaTextWidth returns the width of the WinAnsi encoded text b set
+// in Helvetica at size.
+func HelveticaTextWidth(b []byte, size float64) float64 {
+	w := 0
+	for _, c := range b {
+		w += HelveticaWidth(c)
+	}
+	return float64(w) * size / 1000
+}
+
+var winAnsiHigh = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91,
+	'’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98,
+	'™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// WinAnsi encodes s in WinAnsiEncoding, replacing characters outside of
+// it with a question mark.
+func WinAnsi(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+			b = append(b, byte(r))
+		case winAnsiHigh[r] != 0:
+			b = append(b, winAnsiHigh[r])
+		default:
+			b = append(b, '?')
+		}
+	}
+	return b
+}
+
+// standardFonts maps the base names of the standard 14 fonts, which need
+// no embedding, to whether they use a fixed width.
+var standardFonts = map[Name]bool{
+	"Helvetica": false, "Helvetica-Bold": false, "Helvetica-Oblique": false,
+	"Helvetica-BoldOblique": false, "Times-Roman": false, "Times-Bold": false,
+	"Times-Italic": false, "Times-BoldItalic": false, "Courier": true,
+	"Courier-Bold": true, "Courier-Oblique": true, "Courier-BoldOblique": true,
+	"Symbol": false, "ZapfDingbats": false,
+}
+
+// font is a simple font used to set text in generated appearances.
+type font struct {
+	name  Name
+	ref   Object
+	first int
+	wids  []float64
+	fixed bool
+	miss  float64
+}
+
+// width returns the width of the encoded text b at size.
+func (f *font) width(b []byte, size float64) float64 {
+	w := 0.0
+	for _, c := range b {
+		switch {
+		case f.fixed:
+			w += 600
+		case f.wids != nil:
+			i := int(c) - f.first
+			if i >= 0 && i < len(f.wids) {
+				w += f.wids[i]
+			} else {
+				w += f.miss
+			}
+		default:
+			w += float64(HelveticaWidth(c))
+		}
+	}
+	return w * size / 1000
+}
+
+// loadFont inspects the font dictionary o and returns it if text can be
+// set in it with WinAnsiEncoding.
+func (d *Document) loadFont(name Name, o Object) *font {
+	fd := d.Dict(o)
+	if fd == nil {
+		return nil
+	}
+	switch fd.Name("Subtype") {
+	case "Type1", "TrueType", "MMType1":
+	default:
+		return nil
+	}
+	base := fd.Name("BaseFont")
+	fixed, standard := standardFonts[base]
+	enc := d.Resolve(fd["Encoding"])
+	switch {
+	case enc == Name("WinAnsiEncoding"):
+	case enc == nil && standard && base != "Symbol" && base != "ZapfDingbats":
+	default:
+		return nil
+	}
+	f := &font{name: name, ref: o, fixed: fixed, miss: 500}
+	if widths := d.Array(fd["Widths"]); widths != nil && !standard {
+		f.first = int(d.Number(fd["FirstChar"]))
+		f.wids = make([]float64, len(widths))
+		for i, w := range widths {
+			f.wids[i] = d.Number(w)
+		}
+		if desc := d.Dict(fd["FontDescriptor"]); desc != nil {
+			if mw, ok := desc["MissingWidth"]; ok {
+				f.miss = d.Number(mw)
+			}
+		}
+	}
+	return f
+}
+
+// helvetica returns a Helvetica font for appearances whose own font
+// cannot be used, adding its dictionary to the document once.
+func (d *Document) helvetica() *font {
+	if d.helv == nil {
+		d.helv = &font{name: "Helv", ref: d.Add(Dict{
+			"Type":     Name("Font"),
+			"Subtype":  Name("Type1"),
+			"BaseFont": Name("Helvetica"),
+			"Encoding": Name("WinAnsiEncoding"),
+		})}
+	}
+	return d.helv
+}
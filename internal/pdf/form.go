@@ -0,0 +1,245 @@
+package pdf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Field flags, see section 12.7 of the pdf specification.
+const (
+	flagMultiline   = 1 << 12
+	flagPassword    = 1 << 13
+	flagRadio       = 1 << 15
+	flagPushbutton  = 1 << 16
+	flagCombo       = 1 << 17
+	flagComb        = 1 << 24
+	annotHidden     = 1 << 1
+	maxFieldDepth   = 32
+	defaultFontSize = 12
+)
+
+// Field is a terminal field of an interactive form.
+type Field struct {
+	Name    string
+	Ref     Ref
+	Dict    Dict
+	Widgets []Ref
+}
+
+// AcroForm returns the interactive form dictionary of the document.
+func (d *Document) AcroForm() Dict {
+	return d.Dict(d.Catalog()["AcroForm"])
+}
+
+// Fields returns the terminal fields of the document's form in document
+// order, named by their fully qualified names.
+func (d *Document) Fields() []*Field {
+	form := d.AcroForm()
+	if form == nil {
+		return nil
+	}
+	fields := []*Field{}
+	seen := map[int]bool{}
+	var walk func(o Object, parent string, depth int)
+	walk = func(o Object, parent string, depth int) {
+		r, ok := o.(Ref)
+		if !ok || seen[r.Num] || depth > maxFieldDepth {
+			return
+		}
+		seen[r.Num] = true
+		f := d.Dict(r)
+		if f == nil {
+			return
+		}
+		name := parent
+		if t, ok := d.Resolve(f["T"]).(String); ok {
+			if name != "" {
+				name += "."
+			}
+			name += Text(t)
+		}
+		widgets := []Ref{}
+		terminal := true
+		for _, k := range d.Array(f["Kids"]) {
+			kid := d.Dict(k)
+			if kid == nil {
+				continue
+			}
+			if _, ok := kid["T"]; ok {
+				terminal = false
+				walk(k, name, depth+1)
+			} else if kr, ok := k.(Ref); ok {
+				widgets = append(widgets, kr)
+			}
+		}
+		if !terminal {
+			return
+		}
+		if f.Name("Subtype") == "Widget" {
+			widgets = append(widgets, r)
+		}
+		fields = append(fields, &Field{Name: name, Ref: r, Dict: f, Widgets: widgets})
+	}
+	for _, f := range d.Array(form["Fields"]) {
+		walk(f, "", 0)
+	}
+	return fields
+}
+
+// inherited looks up key on the field f or its nearest ancestor.
+func (d *Document) inheritedField(f Dict, key Name) Object {
+	for i := 0; f != nil && i < maxFieldDepth; i++ {
+		if v, ok := f[key]; ok {
+			return d.Resolve(v)
+		}
+		f = d.Dict(f["Parent"])
+	}
+	if form := d.AcroForm(); form != nil && (key == "DA" || key == "Q") {
+		return d.Resolve(form[key])
+	}
+	return nil
+}
+
+// Fill sets the values of the named fields and regenerates their
+// appearances. Names that do not match a field are ignored.
+func (d *Document) Fill(values map[string]string) error {
+	for _, f := range d.Fields() {
+		v, ok := values[f.Name]
+		if !ok {
+			continue
+		}
+		if err := d.fillField(f, v); err != nil {
+			return fmt.Errorf("pdf: field %q: %v", f.Name, err)
+		}
+	}
+	return nil
+}
+
+func (d *Document) fillField(f *Field, value string) error {
+	ft, _ := d.inheritedField(f.Dict, "FT").(Name)
+	flags := int(d.Number(d.inheritedField(f.Dict, "Ff")))
+	switch ft {
+	case "Tx":
+		f.Dict["V"] = TextString(value)
+		for _, w := range f.Widgets {
+			if err := d.textAppearance(f, d.Dict(w), value, flags); err != nil {
+				return err
+			}
+		}
+	case "Ch":
+		export, display, index := d.choice(f.Dict, value)
+		f.Dict["V"] = TextString(export)
+		if index >= 0 {
+			f.Dict["I"] = Array{index}
+		} else {
+			delete(f.Dict, "I")
+		}
+		for _, w := range f.Widgets {
+			var err error
+			if flags&flagCombo != 0 {
+				err = d.textAppearance(f, d.Dict(w), display, 0)
+			} else {
+				err = d.listAppearance(f, d.Dict(w), index)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	case "Btn":
+		if flags&flagPushbutton != 0 {
+			return nil
+		}
+		d.setButton(f, value, flags&flagRadio != 0)
+	}
+	return nil
+}
+
+// choice maps value to an option of a choice field, returning the export
+// value, the displayed text and the option index, or -1 if value is not
+// one of the options.
+func (d *Document) choice(f Dict, value string) (string, string, int) {
+	opts, _ := d.inheritedField(f, "Opt").(Array)
+	for i, o := range opts {
+		export, display := "", ""
+		switch v := d.Resolve(o).(type) {
+		case String:
+			export = Text(v)
+			display = export
+		case Array:
+			if len(v) == 2 {
+				e, _ := d.Resolve(v[0]).(String)
+				t, _ := d.Resolve(v[1]).(String)
+				export, display = Text(e), Text(t)
+			}
+		}
+		if value == export || value == display {
+			return export, display, i
+		}
+	}
+	return value, value, -1
+}
+
+// onStates returns the appearance states of a button widget other than
+// Off.
+func (d *Document) onStates(w Dict) []Name {
+	states := []Name{}
+	if ap := d.Dict(w["AP"]); ap != nil {
+		n, _ := d.Resolve(ap["N"]).(Dict)
+		for _, k := range sortedKeys(n) {
+			if k != "Off" {
+				states = append(states, k)
+			}
+		}
+	}
+	return states
+}
+
+func isOff(value string) bool {
+	switch strings.ToLower(value) {
+	case "", "off", "no", "false", "0":
+		return true
+	}
+	return false
+}
+
+// setButton sets a check box or radio button to the state named by value.
+// For check boxes any value other than an explicit off value turns the box
+// on.
+func (d *Document) setButton(f *Field, value string, radio bool) {
+	state := Name("Off")
+	if !isOff(value) {
+		for _, w := range f.Widgets {
+			for _, s := range d.onStates(d.Dict(w)) {
+				if string(s) == value {
+					state = s
+				}
+			}
+		}
+		if state == "Off" && !radio {
+			state = "Yes"
+			for _, w := range f.Widgets {
+				if s := d.onStates(d.Dict(w)); len(s) > 0 {
+					state = s[0]
+					break
+				}
+			}
+		}
+	}
+	f.Dict["V"] = state
+	for _, r := range f.Widgets {
+		w := d.Dict(r)
+		as := Name("Off")
+		for _, s := range d.onStates(w) {
+			if s == state {
+				as = s
+			}
+		}
+		if as != "Off" || len(d.onStates(w)) > 0 {
+			w["AS"] = as
+			continue
+		}
+		// Generate a check mark for widgets without appearances.
+		w["AS"] = state
+		d.checkAppearance(w, state)
+	}
+}
@@ -0,0 +1,103 @@
+package pdf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func fieldMap(d *Document) map[string]*Field {
+	m := map[string]*Field{}
+	for _, f := range d.Fields() {
+		m[f.Name] = f
+	}
+	return m
+}
+
+func TestFields(t *testing.T) {
+	fields := fieldMap(openTestForm(t))
+	if len(fields) != 17 {
+		t.Fatalf("Expected 17 fields, got %d", len(fields))
+	}
+	for _, name := range []string{"Family Name Text Box", "Driving License Check Box", "Favourite Colour List Box", "Country Combo Box"} {
+		if _, ok := fields[name]; !ok {
+			t.Fatalf("Missing field %q", name)
+		}
+	}
+}
+
+func TestFill(t *testing.T) {
+	d := openTestForm(t)
+	err := d.Fill(map[string]string{
+		"Family Name Text Box":      "Þórsson (jr)",
+		"Driving License Check Box": "Yes",
+		"Language 2 Check Box":      "Off",
+		"Favourite Colour List Box": "Blue",
+		"Country Combo Box":         "Spain",
+		"Unknown":                   "ignored",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err = Open(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := fieldMap(d)
+	name := fields["Family Name Text Box"]
+	if v := Text(name.Dict["V"].(String)); v != "Þórsson (jr)" {
+		t.Fatalf("Got value %q", v)
+	}
+	_, ap := d.normalAppearance(name.Dict)
+	content, err := d.Decode(ap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(content, []byte("(\xde\xf3rsson \\(jr\\)) Tj")) {
+		t.Fatalf("Expected the value in the appearance, got %q", content)
+	}
+	if as := fields["Driving License Check Box"].Dict["AS"]; as != Name("Yes") {
+		t.Fatalf("Expected the check box to be on, got %v", as)
+	}
+	if as := fields["Language 2 Check Box"].Dict["AS"]; as != Name("Off") {
+		t.Fatalf("Expected the check box to be off, got %v", as)
+	}
+	if v := Text(fields["Country Combo Box"].Dict["V"].(String)); v != "Spain" {
+		t.Fatalf("Got value %q", v)
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	d := openTestForm(t)
+	if err := d.Fill(map[string]string{"Given Name Text Box": "Jón"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Flatten(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.Bytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err = Open(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(d.Fields()) != 0 {
+		t.Fatal("Expected no fields after flattening")
+	}
+	page := d.Dict(d.Pages()[0])
+	if _, ok := page["Annots"]; ok {
+		t.Fatal("Expected widgets to be removed")
+	}
+	content, err := d.Contents(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(content, []byte("/Fl0 Do")) {
+		t.Fatalf("Expected appearances to be drawn, got %q", content[len(content)-200:])
+	}
+}
@@ -0,0 +1,126 @@
+package pdf
+
+// InfoMap returns the text entries of the document information
+// dictionary.
+func (d *Document) InfoMap() map[string]string {
+	m := map[string]string{}
+	for k, v := range d.Info(false) {
+		if s, ok := d.Resolve(v).(String); ok {
+			m[string(k)] = Text(s)
+		}
+	}
+	return m
+}
+
+// SetInfo sets entries of the document information dictionary. An empty
+// value removes the entry.
+func (d *Document) SetInfo(m map[string]string) {
+	if len(m) == 0 {
+		return
+	}
+	info := d.Info(true)
+	for k, v := range m {
+		if v == "" {
+			delete(info, Name(k))
+		} else {
+			info[Name(k)] = TextString(v)
+		}
+	}
+}
+
+// Bookmark is an outline entry pointing at a zero based page index.
+// Level 1 entries are at the top of the outline.
+type Bookmark struct {
+	Title string
+	Level int
+	Page  int
+}
+
+// SetOutline replaces the document outline with bookmarks.
+func (d *Document) SetOutline(bookmarks []Bookmark) {
+	cat := d.Catalog()
+	if len(bookmarks) == 0 {
+		return
+	}
+	pages := d.Pages()
+	root := Dict{"Type": Name("Outlines")}
+	rootRef := d.Add(root)
+
+	type node struct {
+		ref   Ref
+		dict  Dict
+		level int
+	}
+	stack := []node{{rootRef, root, 0}}
+	last := map[int]node{}
+	for _, b := range bookmarks {
+		level := b.Level
+		if level < 1 {
+			level = 1
+		}
+		for len(stack) > 1 && stack[len(stack)-1].level >= level {
+			stack = stack[:len(stack)-1]
+		}
+		parent := stack[len(stack)-1]
+		item := Dict{"Title": TextString(b.Title), "Parent": parent.ref}
+		if b.Page >= 0 && b.Page < len(pages) {
+			item["Dest"] = Array{pages[b.Page], Name("XYZ"), nil, nil, nil}
+		}
+		ref := d.Add(item)
+		if prev, ok := last[parent.ref.Num]; ok {
+			prev.dict["Next"] = ref
+			item["Prev"] = prev.ref
+		} else {
+			parent.dict["First"] = ref
+		}
+		parent.dict["Last"] = ref
+		last[parent.ref.Num] = node{ref, item, level}
+		for _, n := range stack {
+			n.dict["Count"] = n.dict.Int("Count") + 1
+		}
+		stack = append(stack, node{ref, item, parent.level + 1})
+	}
+	cat["Outlines"] = rootRef
+	if _, ok := cat["PageMode"]; !ok {
+		cat["PageMode"] = Name("UseOutlines")
+	}
+}
+
+// Outline returns the entries of the document outline in order. The page
+// of an entry without a destination in the document is -1.
+func (d *Document) Outline() []Bookmark {
+	index := map[int]int{}
+	for i, r := range d.Pages() {
+		index[r.Num] = i
+	}
+	bookmarks := []Bookmark{}
+	seen := map[int]bool{}
+	var walk func(o Object, level int)
+	walk = func(o Object, level int) {
+		for r, ok := o.(Ref); ok && !seen[r.Num]; r, ok = o.(Ref) {
+			seen[r.Num] = true
+			item := d.Dict(r)
+			if item == nil {
+				return
+			}
+			title, _ := d.Resolve(item["Title"]).(String)
+			b := Bookmark{Title: Text(title), Level: level, Page: -1}
+			dest := item["Dest"]
+			if a := d.Dict(item["A"]); dest == nil && a.Name("S") == "GoTo" {
+				dest = a["D"]
+			}
+			if da := d.Array(dest); len(da) > 0 {
+				if p, ok := da[0].(Ref); ok {
+					if i, ok := index[p.Num]; ok {
+						b.Page = i
+					}
+				}
+			}
+			bookmarks = append(bookmarks, b)
+			walk(item["First"], level+1)
+			o = item["Next"]
+		}
+	}
+	walk(d.Dict(d.Catalog()["Outlines"])["First"], 1)
+	return bookmarks
+}
@@ -0,0 +1,109 @@
+// Package pdf reads, modifies and writes pdf files. It implements the
+// subset of the format needed to fill and flatten AcroForms and to split,
+// merge, stamp and annotate documents, without any external tools.
+package pdf
+
+import (
+	"bytes"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Object is one of nil, bool, int, float64, Name, String, Array, Dict,
+// Ref or *Stream.
+type Object interface{}
+
+// Name is a pdf name object, without the leading slash.
+type Name string
+
+// String is a pdf string object holding raw bytes.
+type String []byte
+
+// Array is a pdf array.
+type Array []Object
+
+// Dict is a pdf dictionary.
+type Dict map[Name]Object
+
+// Ref is an indirect reference to an object of a Document.
+type Ref struct {
+	Num, Gen int
+}
+
+// Stream is a pdf stream. Data holds the stream as stored in the file,
+// that is still encoded with the filters listed in Dict.
+type Stream struct {
+	Dict Dict
+	Data []byte
+}
+
+// Name returns the value of k in d if it is a name.
+func (d Dict) Name(k Name) Name {
+	n, _ := d[k].(Name)
+	return n
+}
+
+// Int returns the value of k in d if it is a number.
+func (d Dict) Int(k Name) int {
+	switch v := d[k].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// Text decodes a pdf text string, which is either UTF-16BE with a byte
+// order mark or PDFDocEncoding.
+func Text(s String) string {
+	if len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff {
+		u := make([]uint16, 0, len(s)/2)
+		for i := 2; i+1 < len(s); i += 2 {
+			u = append(u, uint16(s[i])<<8|uint16(s[i+1]))
+		}
+		return string(utf16.Decode(u))
+	}
+	if utf8.Valid(s) && bytes.IndexFunc(s, func(r rune) bool { return r >= 0x80 }) < 0 {
+		return string(s)
+	}
+	r := make([]rune, len(s))
+	for i, c := range s {
+		r[i] = pdfDocRune(c)
+	}
+	return string(r)
+}
+
+// pdfDocRune maps a PDFDocEncoding byte to its rune. The encoding matches
+// Latin-1 except for the range 0x80 to 0x9f.
+func pdfDocRune(c byte) rune {
+	if c >= 0x80 && c <= 0x9f {
+		return pdfDocHigh[c-0x80]
+	}
+	return rune(c)
+}
+
+var pdfDocHigh = [32]rune{
+	'•', '†', '‡', '…', '—', '–', 'ƒ', '⁄', '‹', '›', '−', '‰', '„', '“', '”', '‘',
+	'’', '‚', '™', 'ﬁ', 'ﬂ', 'Ł', 'Œ', 'Š', 'Ÿ', 'Ž', 'ı', 'ł', 'œ', 'š', 'ž', '�',
+}
+
+// TextString encodes s as a pdf text string, using UTF-16BE unless s is
+// plain ASCII.
+func TextString(s string) String {
+	ascii := true
+	for _, r := range s {
+		if r >= 0x80 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return String(s)
+	}
+	b := []byte{0xfe, 0xff}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = append(b, byte(u>>8), byte(u))
+	}
+	return String(b)
+}
@@ -0,0 +1,323 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+func isSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func isRegular(c byte) bool {
+	return !isSpace(c) && !isDelim(c)
+}
+
+// parser reads pdf objects from a byte slice.
+type parser struct {
+	b   []byte
+	pos int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("pdf: offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.b) {
+		c := p.b[p.pos]
+		if c == '%' {
+			for p.pos < len(p.b) && p.b[p.pos] != '\n' && p.b[p.pos] != '\r' {
+				p.pos++
+			}
+			continue
+		}
+		if !isSpace(c) {
+			return
+		}
+		p.pos++
+	}
+}
+
+// keyword reads the run of regular characters at the current position.
+func (p *parser) keyword() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.b) && isRegular(p.b[p.pos]) {
+		p.pos++
+	}
+	return string(p.b[start:p.pos])
+}
+
+// expect consumes kw or fails.
+func (p *parser) expect(kw string) error {
+	if k := p.keyword(); k != kw {
+		return p.errorf("expected %q, found %q", kw, k)
+	}
+	return nil
+}
+
+func (p *parser) integer() (int, error) {
+	k := p.keyword()
+	n, err := strconv.Atoi(k)
+	if err != nil {
+		return 0, p.errorf("expected integer, found %q", k)
+	}
+	return n, nil
+}
+
+// object reads the next direct object. Streams are handled by the caller,
+// since their length may be an indirect reference.
+func (p *parser) object() (Object, error) {
+	p.skipSpace()
+	if p.pos >= len(p.b) {
+		return nil, p.errorf("unexpected end of data")
+	}
+	switch c := p.b[p.pos]; c {
+	case '/':
+		p.pos++
+		return p.name(), nil
+	case '(':
+		p.pos++
+		return p.literal()
+	case '<':
+		if p.pos+1 < len(p.b) && p.b[p.pos+1] == '<' {
+			p.pos += 2
+			return p.dict()
+		}
+		p.pos++
+		return p.hex()
+	case '[':
+		p.pos++
+		return p.array()
+	case ']', '>', ')', '}', '{':
+		return nil, p.errorf("unexpected %q", c)
+	}
+	k := p.keyword()
+	switch k {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	case "":
+		return nil, p.errorf("unexpected %q", p.b[p.pos])
+	}
+	return p.number(k)
+}
+
+func (p *parser) number(k string) (Object, error) {
+	n, err := strconv.Atoi(k)
+	if err != nil {
+		f, err := strconv.ParseFloat(k, 64)
+		if err != nil {
+			return nil, p.errorf("unexpected %q", k)
+		}
+		return f, nil
+	}
+	// An integer may start a "num gen R" reference.
+	save := p.pos
+	if n >= 0 {
+		if gen, err := strconv.Atoi(p.keyword()); err == nil && gen >= 0 {
+			if p.keyword() == "R" {
+				return Ref{n, gen}, nil
+			}
+		}
+	}
+	p.pos = save
+	return n, nil
+}
+
+func unhex(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func (p *parser) name() Name {
+	var buf bytes.Buffer
+	for p.pos < len(p.b) && isRegular(p.b[p.pos]) {
+		c := p.b[p.pos]
+		if c == '#' && p.pos+2 < len(p.b) {
+			h, ok1 := unhex(p.b[p.pos+1])
+			l, ok2 := unhex(p.b[p.pos+2])
+			if ok1 && ok2 {
+				buf.WriteByte(h<<4 | l)
+				p.pos += 3
+				continue
+			}
+		}
+		buf.WriteByte(c)
+		p.pos++
+	}
+	return Name(buf.String())
+}
+
+func (p *parser) literal() (Object, error) {
+	var buf bytes.Buffer
+	depth := 1
+	for p.pos < len(p.b) {
+		c := p.b[p.pos]
+		p.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return String(buf.Bytes()), nil
+			}
+		case '\r':
+			// An end of line in a string is read as a single newline.
+			if p.pos < len(p.b) && p.b[p.pos] == '\n' {
+				p.pos++
+			}
+			c = '\n'
+		case '\\':
+			if p.pos >= len(p.b) {
+				continue
+			}
+			c = p.b[p.pos]
+			p.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if p.pos < len(p.b) && p.b[p.pos] == '\n' {
+					p.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := int(c - '0')
+					for i := 0; i < 2 && p.pos < len(p.b) && p.b[p.pos] >= '0' && p.b[p.pos] <= '7'; i++ {
+						v = v*8 + int(p.b[p.pos]-'0')
+						p.pos++
+					}
+					c = byte(v)
+				}
+			}
+		}
+		buf.WriteByte(c)
+	}
+	return nil, p.errorf("unterminated string")
+}
+
+func (p *parser) hex() (Object, error) {
+	var buf bytes.Buffer
+	var hi byte
+	odd := false
+	for p.pos < len(p.b) {
+		c := p.b[p.pos]
+		p.pos++
+		if c == '>' {
+			if odd {
+				buf.WriteByte(hi << 4)
+			}
+			return String(buf.Bytes()), nil
+		}
+		v, ok := unhex(c)
+		if !ok {
+			continue
+		}
+		if odd {
+			buf.WriteByte(hi<<4 | v)
+		} else {
+			hi = v
+		}
+		odd = !odd
+	}
+	return nil, p.errorf("unterminated hex string")
+}
+
+func (p *parser) array() (Object, error) {
+	a := Array{}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.b) {
+			return nil, p.errorf("unterminated array")
+		}
+		if p.b[p.pos] == ']' {
+			p.pos++
+			return a, nil
+		}
+		o, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, o)
+	}
+}
+
+func (p *parser) dict() (Object, error) {
+	d := Dict{}
+	for {
+		p.skipSpace()
+		if p.pos+1 >= len(p.b) {
+			return nil, p.errorf("unterminated dictionary")
+		}
+		if p.b[p.pos] == '>' && p.b[p.pos+1] == '>' {
+			p.pos += 2
+			return d, nil
+		}
+		if p.b[p.pos] != '/' {
+			return nil, p.errorf("expected name in dictionary")
+		}
+		p.pos++
+		k := p.name()
+		v, err := p.object()
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			d[k] = v
+		}
+	}
+}
+
+// streamStart positions the parser at the data of a stream if the
+// keyword "stream" follows and reports whether it did.
+func (p *parser) streamStart() bool {
+	save := p.pos
+	if p.keyword() != "stream" {
+		p.pos = save
+		return false
+	}
+	if p.pos < len(p.b) && p.b[p.pos] == '\r' {
+		p.pos++
+	}
+	if p.pos < len(p.b) && p.b[p.pos] == '\n' {
+		p.pos++
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
+
+// pageBox returns the visible area of page, its crop box if it has one.
+func (d *Document) pageBox(page Dict) [4]float64 {
+	if r, ok := d.Rect(d.Inherited(page, "CropBox")); ok {
+		return r
+	}
+	return d.MediaBox(page)
+}
+
+// Contents returns the decoded content of page.
+func (d *Document) Contents(page Dict) ([]byte, error) {
+	var streams Array
+	switch c := d.Resolve(page["Contents"]).(type) {
+	case *Stream:
+		streams = Array{c}
+	case Array:
+		streams = c
+	}
+	var buf bytes.Buffer
+	for _, o := range streams {
+		s, ok := d.Resolve(o).(*Stream)
+		if !ok {
+			continue
+		}
+		b, err := d.Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// Stamp draws page i of overlay on top of page i of d, repeating the
+// last overlay page if d has more pages. Each overlay page is scaled to
+// fit the page it is drawn on.
+func (d *Document) Stamp(overlay *Document) error {
+	stamps := overlay.Pages()
+	if len(stamps) == 0 {
+		return nil
+	}
+	c := newCopier(overlay, d)
+	forms := map[int]Ref{}
+	for i, pr := range d.Pages() {
+		n := i
+		if n >= len(stamps) {
+			n = len(stamps) - 1
+		}
+		sp := overlay.Dict(stamps[n])
+		box := overlay.pageBox(sp)
+		form, ok := forms[n]
+		if !ok {
+			content, err := overlay.Contents(sp)
+			if err != nil {
+				return err
+			}
+			dict := Dict{
+				"Type":    Name("XObject"),
+				"Subtype": Name("Form"),
+				"BBox":    Array{box[0], box[1], box[2], box[3]},
+				"Filter":  Name("FlateDecode"),
+			}
+			if res := overlay.Inherited(sp, "Resources"); res != nil {
+				dict["Resources"] = c.copy(res)
+			}
+			form = d.Add(&Stream{Dict: dict, Data: deflate(content)})
+			forms[n] = form
+		}
+
+		page := d.Dict(pr)
+		target := d.pageBox(page)
+		sw, sh := box[2]-box[0], box[3]-box[1]
+		tw, th := target[2]-target[0], target[3]-target[1]
+		if sw <= 0 || sh <= 0 {
+			continue
+		}
+		scale := math.Min(tw/sw, th/sh)
+		tx := target[0] + (tw-sw*scale)/2 - box[0]*scale
+		ty := target[1] + (th-sh*scale)/2 - box[1]*scale
+		name := d.addXObject(page, "St", form)
+		d.appendContent(page, []byte(fmt.Sprintf("q %s 0 0 %s %s %s cm %s Do Q\n",
+			formatReal(scale), formatReal(scale), formatReal(tx), formatReal(ty), formatName(name))))
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Write serializes the objects reachable from the trailer of d as a
+// complete pdf file. Objects are renumbered in the order they are reached.
+func (d *Document) Write(w io.Writer) error {
+	numbers := map[int]int{}
+	order := []int{}
+	var visit func(o Object)
+	visit = func(o Object) {
+		switch v := o.(type) {
+		case Ref:
+			if _, ok := numbers[v.Num]; ok {
+				return
+			}
+			if _, ok := d.objects[v.Num]; !ok {
+				return
+			}
+			order = append(order, v.Num)
+			numbers[v.Num] = len(order)
+			visit(d.objects[v.Num])
+		case Array:
+			for _, e := range v {
+				visit(e)
+			}
+		case Dict:
+			for _, k := range sortedKeys(v) {
+				visit(v[k])
+			}
+		case *Stream:
+			for _, k := range sortedKeys(v.Dict) {
+				if k != "Length" {
+					visit(v.Dict[k])
+				}
+			}
+		}
+	}
+	trailer := Dict{}
+	for _, k := range []Name{"Root", "Info", "ID"} {
+		if v, ok := d.Trailer[k]; ok {
+			trailer[k] = v
+		}
+	}
+	visit(trailer)
+
+	bw := bufio.NewWriter(w)
+	cw := &countWriter{w: bw}
+	ow := &objectWriter{w: cw, numbers: numbers}
+	fmt.Fprintf(cw, "%%PDF-%s\n%%\xe2\xe3\xcf\xd3\n", d.Version)
+	offsets := make([]int64, len(order))
+	for i, num := range order {
+		offsets[i] = cw.n
+		fmt.Fprintf(cw, "%d 0 obj\n", i+1)
+		ow.write(d.objects[num])
+		io.WriteString(cw, "\nendobj\n")
+	}
+	xref := cw.n
+	fmt.Fprintf(cw, "xref\n0 %d\n0000000000 65535 f \n", len(order)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(cw, "%010d 00000 n \n", off)
+	}
+	trailer["Size"] = len(order) + 1
+	io.WriteString(cw, "trailer\n")
+	ow.write(trailer)
+	fmt.Fprintf(cw, "\nstartxref\n%d\n%%%%EOF\n", xref)
+	if cw.err != nil {
+		return cw.err
+	}
+	return bw.Flush()
+}
+
+// Bytes returns d serialized by Write.
+func (d *Document) Bytes() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := d.Write(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type countWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countWriter) Write(b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+type objectWriter struct {
+	w       io.Writer
+	numbers map[int]int
+}
+
+func sortedKeys(d Dict) []Name {
+	keys := make([]Name, 0, len(d))
+	for k := range d {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func (ow *objectWriter) write(o Object) {
+	switch v := o.(type) {
+	case nil:
+		io.WriteString(ow.w, "null")
+	case bool:
+		io.WriteString(ow.w, strconv.FormatBool(v))
+	case int:
+		io.WriteString(ow.w, strconv.Itoa(v))
+	case float64:
+		io.WriteString(ow.w, formatReal(v))
+	case Name:
+		io.WriteString(ow.w, formatName(v))
+	case String:
+		ow.w.Write(formatString(v))
+	case Ref:
+		if n, ok := ow.numbers[v.Num]; ok {
+			fmt.Fprintf(ow.w, "%d 0 R", n)
+		} else {
+			io.WriteString(ow.w, "null")
+		}
+	case Array:
+		io.WriteString(ow.w, "[")
+		for i, e := range v {
+			if i > 0 {
+				io.WriteString(ow.w, " ")
+			}
+			ow.write(e)
+		}
+		io.WriteString(ow.w, "]")
+	case Dict:
+		io.WriteString(ow.w, "<<")
+		for _, k := range sortedKeys(v) {
+			io.WriteString(ow.w, formatName(k))
+			io.WriteString(ow.w, " ")
+			ow.write(v[k])
+		}
+		io.WriteString(ow.w, ">>")
+	case *Stream:
+		dict := Dict{}
+		for k, e := range v.Dict {
+			dict[k] = e
+		}
+		dict["Length"] = len(v.Data)
+		ow.write(dict)
+		io.WriteString(ow.w, "\nstream\n")
+		ow.w.Write(v.Data)
+		io.WriteString(ow.w, "\nendstream")
+	default:
+		io.WriteString(ow.w, "null")
+	}
+}
+
+func formatReal(f float64) string {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "0"
+	}
+	s := strconv.FormatFloat(f, 'f', 4, 64)
+	s = trimZeros(s)
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+func trimZeros(s string) string {
+	if !strings.Contains(s, ".") {
+		return s
+	}
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func formatName(n Name) string {
+	var buf bytes.Buffer
+	buf.WriteByte('/')
+	for i := 0; i < len(n); i++ {
+		c := n[i]
+		if c < 0x21 || c > 0x7e || c == '#' || isDelim(c) {
+			fmt.Fprintf(&buf, "#%02X", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+func formatString(s String) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte('(')
+	for _, c := range s {
+		switch c {
+		case '(', ')', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\n':
+			buf.WriteString(`\n`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte(')')
+	return buf.Bytes()
+}
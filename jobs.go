@@ -0,0 +1,359 @@
+package pdfhandler
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/satori/go.uuid"
+)
+
+const (
+	defaultJobTTL   = time.Hour
+	defaultMaxJobs  = 1000
+	defaultJobsPath = "/jobs"
+)
+
+const (
+	jobRunning   = "running"
+	jobDone      = "done"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+// asyncJob is a POST rendered in the background, its output kept in a
+// temporary file until the job expires or is deleted.
+type asyncJob struct {
+	id       string
+	task     *task
+	location string
+	// documents is the number of documents of the task, kept after its
+	// content is released.
+	documents int
+	cancel    context.CancelFunc
+
+	mu       sync.Mutex
+	status   string
+	err      string
+	rendered int
+	created  time.Time
+	finished time.Time
+	file     string
+	deleted  bool
+}
+
+// jobInfo is the json status of a job.
+type jobInfo struct {
+	ID        string `json:"id"`
+	RequestID string `json:"request_id"`
+	Status    string `json:"status"`
+	// Documents is the number of documents of the job, Rendered those
+	// finished so far.
+	Documents  int        `json:"documents"`
+	Rendered   int        `json:"rendered"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Result is the path to download the output from, once done.
+	Result string `json:"result,omitempty"`
+}
+
+func (j *asyncJob) info() jobInfo {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	info := jobInfo{
+		ID:        j.id,
+		RequestID: j.task.requestID,
+		Status:    j.status,
+		Documents: j.documents,
+		Rendered:  j.rendered,
+		Error:     j.err,
+		CreatedAt: j.created,
+	}
+	if !j.finished.IsZero() {
+		finished := j.finished
+		info.FinishedAt = &finished
+	}
+	if j.status == jobDone {
+		info.Result = j.location + "/result"
+	}
+	return info
+}
+
+func (j *asyncJob) progress() {
+	j.mu.Lock()
+	j.rendered++
+	j.mu.Unlock()
+}
+
+// finish records the outcome of rendering into file. The output is
+// removed unless the job is done and still wanted. The documents of the
+// task are released, only its options and output headers are kept.
+func (j *asyncJob) finish(ctx context.Context, file string, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.task.PDF = PDF{}
+	j.task.Documents = nil
+	j.finished = time.Now()
+	switch {
+	case ctx.Err() != nil:
+		j.status = jobCancelled
+	case err != nil:
+		j.status = jobFailed
+		j.err = err.Error()
+	default:
+		j.status = jobDone
+	}
+	if j.status != jobDone || j.deleted {
+		os.Remove(file)
+		return
+	}
+	j.file = file
+}
+
+// remove cancels j and removes its output.
+func (j *asyncJob) remove() {
+	j.cancel()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.deleted = true
+	if j.file != "" {
+		os.Remove(j.file)
+		j.file = ""
+	}
+}
+
+// jobStore holds the jobs of a handler, finished jobs for ttl, and at
+// most max jobs at a time if max is positive.
+type jobStore struct {
+	ttl  time.Duration
+	max  int
+	mu   sync.Mutex
+	jobs map[string]*asyncJob
+}
+
+func newJobStore(ttl time.Duration, max int) *jobStore {
+	return &jobStore{ttl: ttl, max: max, jobs: map[string]*asyncJob{}}
+}
+
+// add stores j, unless the store is full.
+func (s *jobStore) add(j *asyncJob) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.max > 0 && len(s.jobs) >= s.max {
+		return false
+	}
+	s.jobs[j.id] = j
+	return true
+}
+
+func (s *jobStore) get(id string) *asyncJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[id]
+}
+
+// remove deletes the job id, if there is one, and returns it.
+func (s *jobStore) remove(id string) *asyncJob {
+	s.mu.Lock()
+	j := s.jobs[id]
+	delete(s.jobs, id)
+	s.mu.Unlock()
+	if j != nil {
+		j.remove()
+	}
+	return j
+}
+
+// expire removes j once the ttl has passed.
+func (s *jobStore) expire(j *asyncJob) {
+	time.AfterFunc(s.ttl, func() {
+		s.mu.Lock()
+		current := s.jobs[j.id] == j
+		s.mu.Unlock()
+		if current {
+			logger.Debugf("Job %s expired", j.id)
+			s.remove(j.id)
+		}
+	})
+}
+
+// splitJobsPath splits a request path at or below the jobs endpoint at
+// base, e.g. /jobs/<id>/result, into the job id and what follows.
+func splitJobsPath(base, p string) (id, rest string, ok bool) {
+	p = strings.TrimSuffix(p, "/")
+	if p != base && !strings.HasPrefix(p, base+"/") {
+		return "", "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(p, base+"/"), "/")
+	if p == base {
+		parts = nil
+	}
+	switch len(parts) {
+	case 0:
+	case 1:
+		id = parts[0]
+	case 2:
+		id, rest = parts[0], parts[1]
+	default:
+		return "", "", false
+	}
+	return id, rest, true
+}
+
+func (p PDFHandler) serveJobs(w http.ResponseWriter, req *http.Request, id, rest string) {
+	switch {
+	case id == "" && req.Method == "POST":
+		p.postJob(w, req)
+	case id == "":
+		Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	case rest == "" && req.Method == "GET":
+		p.getJob(w, id)
+	case rest == "" && req.Method == "DELETE":
+		p.deleteJob(w, id)
+	case rest == "result" && req.Method == "GET":
+		p.getJobResult(w, req, id)
+	case rest == "" || rest == "result":
+		Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// postJob starts rendering a POST body in the background.
+func (p PDFHandler) postJob(w http.ResponseWriter, req *http.Request) {
+	t, err := p.decodePost(req, false)
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	if t.CallbackURL != "" {
+		if err := p.webhooks.check(t.CallbackURL); err != nil {
+			badRequest(w, err)
+			return
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &asyncJob{
+		id:        uuid.NewV4().String(),
+		task:      t,
+		documents: t.documents(),
+		cancel:    cancel,
+		status:    jobRunning,
+		created:   time.Now(),
+	}
+	j.location = p.jobsPath + "/" + j.id
+	t.async = true
+	t.onRendered = j.progress
+	if !p.asyncJobs.add(j) {
+		cancel()
+		Error(w, "Too many jobs", http.StatusServiceUnavailable)
+		return
+	}
+	go p.runJob(ctx, j)
+
+	w.Header().Set("Location", j.location)
+	writeJobInfo(w, http.StatusAccepted, j.info())
+}
+
+func (p PDFHandler) runJob(ctx context.Context, j *asyncJob) {
+	defer j.cancel()
+	f, err := ioutil.TempFile("", "job")
+	if err != nil {
+		j.finish(ctx, "", err)
+		p.asyncJobs.expire(j)
+		p.notify(j)
+		return
+	}
+	err = withTimeout(ctx, p.requestTimeout, "Job", func(ctx context.Context) error {
+		return p.render(ctx, j.task, f)
+	})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		logger.Errorf("Job %s failed: %q", j.id, err.Error())
+	}
+	j.finish(ctx, f.Name(), err)
+	p.asyncJobs.expire(j)
+	p.notify(j)
+}
+
+// notify posts the outcome of j to its callback url, if it has one and
+// was not cancelled.
+func (p PDFHandler) notify(j *asyncJob) {
+	if j.task.CallbackURL == "" {
+		return
+	}
+	info := j.info()
+	e := webhookEvent{Job: info, Links: webhookLinks{Status: p.publicURL + j.location}}
+	switch info.Status {
+	case jobDone:
+		e.Type = "job.done"
+		e.Links.Result = p.publicURL + info.Result
+	case jobFailed:
+		e.Type = "job.failed"
+	default:
+		return
+	}
+	if err := p.webhooks.deliver(j.task.CallbackURL, e); err != nil {
+		logger.Errorf("Delivering %s of job %s failed: %q", e.Type, j.id, err.Error())
+	}
+}
+
+func (p PDFHandler) getJob(w http.ResponseWriter, id string) {
+	j := p.asyncJobs.get(id)
+	if j == nil {
+		Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	writeJobInfo(w, http.StatusOK, j.info())
+}
+
+func (p PDFHandler) getJobResult(w http.ResponseWriter, req *http.Request, id string) {
+	j := p.asyncJobs.get(id)
+	if j == nil {
+		Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	j.mu.Lock()
+	status, file, finished := j.status, j.file, j.finished
+	var f *os.File
+	var err error
+	if file != "" {
+		f, err = os.Open(file)
+	}
+	j.mu.Unlock()
+	if status != jobDone || file == "" {
+		Error(w, "Job is "+status, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	j.task.setHeaders(w.Header())
+	http.ServeContent(w, req, "", finished, f)
+}
+
+func (p PDFHandler) deleteJob(w http.ResponseWriter, id string) {
+	if p.asyncJobs.remove(id) == nil {
+		Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJobInfo(w http.ResponseWriter, status int, info jobInfo) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		logger.Errorf("Writing job status: %q", err.Error())
+	}
+}
@@ -0,0 +1,271 @@
+package pdfhandler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitJobsPath(t *testing.T) {
+	for p, expected := range map[string][2]string{
+		"/pdf/jobs":            {"", ""},
+		"/pdf/jobs/":           {"", ""},
+		"/pdf/jobs/abc":        {"abc", ""},
+		"/pdf/jobs/abc/result": {"abc", "result"},
+		"/pdf/jobs/abc/res":    {"abc", "res"},
+	} {
+		id, rest, ok := splitJobsPath("/pdf/jobs", p)
+		assert.True(t, ok, p)
+		assert.Equal(t, expected, [2]string{id, rest}, p)
+	}
+	for _, p := range []string{"/", "/pdf", "/pdf/burst", "/pdf/jobsx", "/jobs", "/jobs/pdf/jobs", "/pdf/jobs/a/b/c"} {
+		_, _, ok := splitJobsPath("/pdf/jobs", p)
+		assert.False(t, ok, p)
+	}
+}
+
+func TestJobsMountedAtJobs(t *testing.T) {
+	SetLogger(&testLogger{t})
+	mux := http.NewServeMux()
+	mux.Handle("/jobs/", newTestHandler(t, WithJobsPath("/jobs/jobs")))
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	// The template listing and other paths below the mount point are not
+	// taken for jobs.
+	resp := doJSON(t, "GET", s.URL+"/jobs/", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = doJSON(t, "GET", s.URL+"/jobs/foo", nil, nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var info jobInfo
+	resp = doJSON(t, "POST", s.URL+"/jobs/jobs", single, &info)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "/jobs/jobs/"+info.ID, resp.Header.Get("Location"))
+	info = waitJob(t, s.URL+resp.Header.Get("Location"))
+	assert.Equal(t, jobDone, info.Status)
+}
+
+func jobServer(t *testing.T, opts ...Option) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/pdf/", newTestHandler(t, append([]Option{WithJobsPath("/pdf/jobs")}, opts...)...))
+	return httptest.NewServer(mux)
+}
+
+func doJSON(t *testing.T, method, url string, body interface{}, v interface{}) *http.Response {
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/pdf")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp
+}
+
+// waitJob polls the job at location until it is no longer running.
+func waitJob(t *testing.T, url string) jobInfo {
+	var info jobInfo
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		doJSON(t, "GET", url, nil, &info)
+		if info.Status != jobRunning {
+			return info
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Job %s still running", url)
+	return info
+}
+
+func TestJob(t *testing.T) {
+	SetLogger(&testLogger{t})
+	s := jobServer(t)
+	defer s.Close()
+
+	var info jobInfo
+	resp := doJSON(t, "POST", s.URL+"/pdf/jobs", multi, &info)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, "/pdf/jobs/"+info.ID, resp.Header.Get("Location"))
+	assert.Equal(t, 2, info.Documents)
+
+	info = waitJob(t, s.URL+resp.Header.Get("Location"))
+	assert.Equal(t, jobDone, info.Status)
+	assert.Equal(t, 2, info.Rendered)
+	assert.NotNil(t, info.FinishedAt)
+	assert.Equal(t, "/pdf/jobs/"+info.ID+"/result", info.Result)
+
+	resp, err := http.Get(s.URL + info.Result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/pdf", resp.Header.Get("Content-Type"))
+	assert.True(t, bytes.HasPrefix(b, []byte("%PDF")))
+
+	resp = doJSON(t, "DELETE", s.URL+"/pdf/jobs/"+info.ID, nil, nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp = doJSON(t, "GET", s.URL+"/pdf/jobs/"+info.ID, nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp = doJSON(t, "GET", s.URL+info.Result, nil, nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestJobInvalid(t *testing.T) {
+	SetLogger(&testLogger{t})
+	s := jobServer(t)
+	defer s.Close()
+	resp := doJSON(t, "POST", s.URL+"/pdf/jobs", map[string]string{"on_error": "ignore"}, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = doJSON(t, "GET", s.URL+"/pdf/jobs", nil, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestJobFailed(t *testing.T) {
+	SetLogger(&testLogger{t})
+	r, _ := testRenderer()
+	s := jobServer(t, WithRenderer(brokenRenderer{r}))
+	defer s.Close()
+
+	broken := PDF{FileName: "OoPdfFormExample.pdf", Fields: map[string]string{"broken": "yes"}}
+	var info jobInfo
+	resp := doJSON(t, "POST", s.URL+"/pdf/jobs", []PDF{multi[0], broken}, &info)
+	info = waitJob(t, s.URL+resp.Header.Get("Location"))
+	assert.Equal(t, jobFailed, info.Status)
+	assert.Contains(t, info.Error, "Document 1 (OoPdfFormExample.pdf) failed")
+	assert.Empty(t, info.Result)
+
+	resp = doJSON(t, "GET", s.URL+resp.Header.Get("Location")+"/result", nil, nil)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
+
+func TestJobCancel(t *testing.T) {
+	SetLogger(&testLogger{t})
+	dir, restore := tempDir(t)
+	defer restore()
+	r, _ := testRenderer()
+	cancelled := make(chan error, 10)
+	// One slot and no queue: a job waits for the slot where a plain POST
+	// would be turned away.
+	s := jobServer(t, WithRenderer(blockingRenderer{r, cancelled}), WithConcurrency(1), WithQueueTimeout(time.Millisecond))
+	defer s.Close()
+
+	var first, second jobInfo
+	resp := doJSON(t, "POST", s.URL+"/pdf/jobs", single, &first)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	resp = doJSON(t, "POST", s.URL+"/pdf/jobs", single, &second)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	resp = doJSON(t, "POST", s.URL+"/pdf/", single, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	time.Sleep(50 * time.Millisecond)
+	doJSON(t, "GET", s.URL+"/pdf/jobs/"+second.ID, nil, &second)
+	assert.Equal(t, jobRunning, second.Status)
+
+	for _, id := range []string{first.ID, second.ID} {
+		resp = doJSON(t, "DELETE", s.URL+"/pdf/jobs/"+id, nil, nil)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Job was not cancelled")
+	}
+	assert.Eventually(t, func() bool {
+		files, _ := ioutil.ReadDir(dir)
+		return len(files) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestJobLimits(t *testing.T) {
+	SetLogger(&testLogger{t})
+	r, _ := testRenderer()
+	cancelled := make(chan error, 10)
+	s := jobServer(t, WithRenderer(blockingRenderer{r, cancelled}), WithMaxJobs(1))
+	defer s.Close()
+
+	var info jobInfo
+	resp := doJSON(t, "POST", s.URL+"/pdf/jobs", single, &info)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	resp = doJSON(t, "POST", s.URL+"/pdf/jobs", single, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	doJSON(t, "DELETE", s.URL+"/pdf/jobs/"+info.ID, nil, nil)
+	resp = doJSON(t, "POST", s.URL+"/pdf/jobs", single, &info)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	doJSON(t, "DELETE", s.URL+"/pdf/jobs/"+info.ID, nil, nil)
+}
+
+func TestJobTimeout(t *testing.T) {
+	SetLogger(&testLogger{t})
+	r, _ := testRenderer()
+	cancelled := make(chan error, 10)
+	s := jobServer(t, WithRenderer(blockingRenderer{r, cancelled}), WithRequestTimeout(50*time.Millisecond))
+	defer s.Close()
+
+	resp := doJSON(t, "POST", s.URL+"/pdf/jobs", single, nil)
+	info := waitJob(t, s.URL+resp.Header.Get("Location"))
+	assert.Equal(t, jobFailed, info.Status)
+	assert.Contains(t, info.Error, "Job timed out after 50ms")
+	assert.Equal(t, context.DeadlineExceeded, <-cancelled)
+}
+
+func TestJobFinishReleasesDocuments(t *testing.T) {
+	j := &asyncJob{
+		task:      &task{request: request{PDF: single, Documents: multi}, contentType: "application/pdf"},
+		documents: len(multi),
+		status:    jobRunning,
+	}
+	j.finish(context.Background(), "", nil)
+	assert.Nil(t, j.task.Documents)
+	assert.Nil(t, j.task.Fields)
+	assert.Equal(t, len(multi), j.info().Documents)
+	h := http.Header{}
+	j.task.setHeaders(h)
+	assert.Equal(t, "application/pdf", h.Get("Content-Type"))
+}
+
+func TestJobTTL(t *testing.T) {
+	SetLogger(&testLogger{t})
+	dir, restore := tempDir(t)
+	defer restore()
+	s := jobServer(t, WithJobTTL(50*time.Millisecond))
+	defer s.Close()
+
+	var info jobInfo
+	resp := doJSON(t, "POST", s.URL+"/pdf/jobs", single, &info)
+	location := s.URL + resp.Header.Get("Location")
+	assert.Eventually(t, func() bool {
+		return doJSON(t, "GET", location, nil, nil).StatusCode == http.StatusNotFound
+	}, 5*time.Second, 10*time.Millisecond)
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(t, files)
+}
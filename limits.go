@@ -0,0 +1,111 @@
+package pdfhandler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"unicode/utf8"
+)
+
+// limitError reports a request that exceeds one of the handler's limits.
+type limitError struct {
+	status int
+	msg    string
+}
+
+func (e limitError) Error() string {
+	return e.msg
+}
+
+// limits caps the size of requests. Zero values mean no limit.
+type limits struct {
+	maxBodyBytes    int64
+	maxDocuments    int
+	maxContentBytes int
+	maxFieldLength  int
+}
+
+// body limits r to the maximum body size.
+func (l limits) body(r io.Reader) io.Reader {
+	if l.maxBodyBytes <= 0 {
+		return r
+	}
+	return &limitedReader{r: r, n: l.maxBodyBytes}
+}
+
+// limitedReader fails with a limitError once more than n bytes are read.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.n {
+		return int(l.n), limitError{http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("Request body exceeds the limit of %d bytes", l.n)}
+	}
+	l.n -= int64(n)
+	return n, err
+}
+
+// check validates the documents of a request against the limits. Each
+// copy of a document counts against the document limit.
+func (l limits) check(pdfs []PDF) error {
+	if l.maxDocuments > 0 {
+		n := 0
+		for i, p := range pdfs {
+			if p.copies() > l.maxDocuments {
+				return limitError{http.StatusRequestEntityTooLarge,
+					fmt.Sprintf("Document %d (%s) asks for %d copies, exceeding the limit of %d documents", i, p.FileName, p.copies(), l.maxDocuments)}
+			}
+			n += p.copies()
+		}
+		if n > l.maxDocuments {
+			return limitError{http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("Request has %d documents, exceeding the limit of %d documents", n, l.maxDocuments)}
+		}
+	}
+	for i, p := range pdfs {
+		if l.maxContentBytes > 0 && p.hasContent() {
+			if n := p.contentLen(); n > l.maxContentBytes {
+				return limitError{http.StatusRequestEntityTooLarge,
+					fmt.Sprintf("Content of document %d (%s) is %d bytes, exceeding the limit of %d bytes", i, p.FileName, n, l.maxContentBytes)}
+			}
+		}
+		if l.maxFieldLength > 0 {
+			for k, v := range p.Fields {
+				if n := utf8.RuneCountInString(v); n > l.maxFieldLength {
+					return limitError{http.StatusBadRequest,
+						fmt.Sprintf("Field %q of document %d (%s) is %d characters long, exceeding the limit of %d characters", k, i, p.FileName, n, l.maxFieldLength)}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// contentLen is the size of the template p brings.
+func (p PDF) contentLen() int {
+	if p.content != nil {
+		return len(p.content)
+	}
+	return decodedLen(p.Content)
+}
+
+// decodedLen is the number of bytes the base64 in s decodes to. Line
+// breaks, which the decoder skips, and padding are not counted.
+func decodedLen(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\r', '\n', '=':
+		default:
+			n++
+		}
+	}
+	return n * 3 / 4
+}
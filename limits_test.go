@@ -0,0 +1,83 @@
+package pdfhandler
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodedLen(t *testing.T) {
+	for _, s := range []string{"", "a", "ab", "abc", "abcd", "abcde", strings.Repeat("x", 100)} {
+		assert.Equal(t, len(s), decodedLen(base64.StdEncoding.EncodeToString([]byte(s))), s)
+	}
+	b, err := base64.StdEncoding.DecodeString(testB64)
+	assert.NoError(t, err)
+	assert.Equal(t, len(b), decodedLen(testB64))
+}
+
+func TestLimitedReader(t *testing.T) {
+	b, err := ioutil.ReadAll(limits{maxBodyBytes: 5}.body(strings.NewReader("12345")))
+	assert.NoError(t, err)
+	assert.Equal(t, "12345", string(b))
+
+	_, err = ioutil.ReadAll(limits{maxBodyBytes: 5}.body(strings.NewReader("123456")))
+	if le, ok := err.(limitError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusRequestEntityTooLarge, le.status)
+	}
+}
+
+func TestLimitsCheck(t *testing.T) {
+	l := limits{maxDocuments: 2, maxContentBytes: 3, maxFieldLength: 3}
+	assert.NoError(t, l.check([]PDF{
+		{FileName: "a.pdf", Fields: map[string]string{"x": "þrí"}},
+		{FileName: "b.pdf", Content: base64.StdEncoding.EncodeToString([]byte("abc"))},
+	}))
+	for _, tc := range []struct {
+		pdfs   []PDF
+		status int
+		msg    string
+	}{
+		{[]PDF{{}, {}, {}}, http.StatusRequestEntityTooLarge, "Request has 3 documents, exceeding the limit of 2 documents"},
+		{[]PDF{{}, {Copies: 2}}, http.StatusRequestEntityTooLarge, "Request has 3 documents, exceeding the limit of 2 documents"},
+		{[]PDF{{FileName: "a.pdf", Copies: 1000000}}, http.StatusRequestEntityTooLarge,
+			"Document 0 (a.pdf) asks for 1000000 copies, exceeding the limit of 2 documents"},
+		{[]PDF{{FileName: "b.pdf", Content: base64.StdEncoding.EncodeToString([]byte("abcd"))}}, http.StatusRequestEntityTooLarge,
+			"Content of document 0 (b.pdf) is 4 bytes, exceeding the limit of 3 bytes"},
+		{[]PDF{{}, {FileName: "a.pdf", Fields: map[string]string{"x": "four"}}}, http.StatusBadRequest,
+			`Field "x" of document 1 (a.pdf) is 4 characters long, exceeding the limit of 3 characters`},
+	} {
+		err := l.check(tc.pdfs)
+		if le, ok := err.(limitError); assert.True(t, ok, "%v", err) {
+			assert.Equal(t, tc.status, le.status)
+			assert.Equal(t, tc.msg, le.Error())
+		}
+	}
+}
+
+func TestPostLimits(t *testing.T) {
+	SetLogger(&testLogger{t})
+	h := newTestHandler(t, WithMaxBodyBytes(1024), WithMaxDocuments(2), WithMaxFieldLength(10))
+
+	long := single
+	long.Fields = map[string]string{"Family Name Text Box": strings.Repeat("x", 11)}
+	for _, tc := range []struct {
+		body   interface{}
+		status int
+		msg    string
+	}{
+		{single, http.StatusOK, ""},
+		{[]PDF{single, single, single}, http.StatusRequestEntityTooLarge, "exceeding the limit of 2 documents"},
+		{request{Documents: []PDF{single, single, single}}, http.StatusRequestEntityTooLarge, "exceeding the limit of 2 documents"},
+		{[]PDF{single, {FileName: single.FileName, Copies: 2}}, http.StatusRequestEntityTooLarge, "Request has 3 documents"},
+		{long, http.StatusBadRequest, "exceeding the limit of 10 characters"},
+		{PDF{FileName: strings.Repeat("x", 2048)}, http.StatusRequestEntityTooLarge, "Request body exceeds the limit of 1024 bytes"},
+	} {
+		resp, body := postJSON(t, h, "application/pdf", tc.body)
+		assert.Equal(t, tc.status, resp.StatusCode)
+		assert.Contains(t, string(body), tc.msg)
+	}
+}
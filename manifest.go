@@ -0,0 +1,48 @@
+package pdfhandler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+)
+
+// manifest is the manifest.json entry of zip output. It is written last,
+// so an archive listing it is complete.
+type manifest struct {
+	RequestID string          `json:"request_id"`
+	Documents []manifestEntry `json:"documents"`
+}
+
+// manifestEntry describes a file of the archive.
+type manifestEntry struct {
+	// Index is the position of the document in the request, from 0.
+	Index      int    `json:"index"`
+	Template   string `json:"template,omitempty"`
+	OutputName string `json:"output_name"`
+	Pages      int    `json:"pages"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+}
+
+// digestWriter counts and hashes what is written through it.
+type digestWriter struct {
+	w    io.Writer
+	hash hash.Hash
+	size int64
+}
+
+func newDigestWriter(w io.Writer) *digestWriter {
+	return &digestWriter{w: w, hash: sha256.New()}
+}
+
+func (d *digestWriter) Write(b []byte) (int, error) {
+	n, err := d.w.Write(b)
+	d.hash.Write(b[:n])
+	d.size += int64(n)
+	return n, err
+}
+
+func (d *digestWriter) sum() string {
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
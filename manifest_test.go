@@ -0,0 +1,78 @@
+package pdfhandler
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var manifestBatch = map[string]interface{}{"documents": multi, "manifest": true}
+
+func TestPostManifest(t *testing.T) {
+	SetLogger(&testLogger{t})
+	resp, body := postJSON(t, withHeader("X-Request-ID", "req-1", pdfHandler), "application/zip", manifestBatch)
+	requireOK(t, resp, body)
+	assert.Equal(t, "req-1", resp.Header.Get("X-Request-ID"))
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{}
+	names := []string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = b
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"OoPdfFormExample.pdf", "OoPdfFormExample (2).pdf", "manifest.json"}, names)
+
+	var m manifest
+	if err := json.Unmarshal(files["manifest.json"], &m); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "req-1", m.RequestID)
+	if !assert.Len(t, m.Documents, 2) {
+		return
+	}
+	for i, e := range m.Documents {
+		b := files[e.OutputName]
+		sum := sha256.Sum256(b)
+		d, err := NativeRenderer{}.DocData(context.Background(), b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, i, e.Index)
+		assert.Equal(t, "OoPdfFormExample.pdf", e.Template)
+		assert.Equal(t, d.NumberOfPages, e.Pages)
+		assert.Equal(t, int64(len(b)), e.Size)
+		assert.Equal(t, hex.EncodeToString(sum[:]), e.SHA256)
+	}
+}
+
+func TestPostManifestRequestID(t *testing.T) {
+	SetLogger(&testLogger{t})
+	resp, _ := postJSON(t, pdfHandler, "application/zip", manifestBatch)
+	assert.NotEmpty(t, resp.Header.Get("X-Request-ID"))
+}
+
+func TestPostManifestInvalidAccept(t *testing.T) {
+	SetLogger(&testLogger{t})
+	resp, _ := postJSON(t, pdfHandler, "application/pdf", manifestBatch)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,223 @@
+package pdfhandler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/StefanKjartansson/pdfhandler/internal/pdf"
+)
+
+// NativeRenderer implements Renderer in Go, without running pdftk. Work
+// in progress can not be interrupted, a done context is noticed between
+// operations and between the documents and pages of Concat and Burst.
+type NativeRenderer struct{}
+
+func (NativeRenderer) Fill(ctx context.Context, w io.Writer, path string, fields map[string]string, flatten bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	d, err := openFile(path)
+	if err != nil {
+		return err
+	}
+	if err := d.Fill(fields); err != nil {
+		return err
+	}
+	if flatten {
+		if err := d.Flatten(); err != nil {
+			return err
+		}
+	}
+	return d.Write(w)
+}
+
+func (NativeRenderer) DumpFields(ctx context.Context, path string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	d, err := openFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fields := d.Fields()
+	names := make([]string, len(fields))
+	for i, f := range fields {
+		names[i] = f.Name
+	}
+	return names, nil
+}
+
+func (NativeRenderer) SelectPages(ctx context.Context, w io.Writer, b []byte, ranges []PageRange) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	d, err := pdf.Open(b)
+	if err != nil {
+		return err
+	}
+	n := len(d.Pages())
+	if err := checkPageRanges(ranges, n); err != nil {
+		return err
+	}
+	refs := []pdf.PageRef{}
+	for _, r := range ranges {
+		from, to := r.From, r.To
+		if from == 0 {
+			from = n
+		}
+		if to == 0 {
+			to = n
+		}
+		step := 1
+		if to < from {
+			step = -1
+		}
+		for i := from; ; i += step {
+			refs = append(refs, pdf.PageRef{Doc: d, Page: i - 1})
+			if i == to {
+				break
+			}
+		}
+	}
+	out, err := pdf.Assemble(refs)
+	if err != nil {
+		return err
+	}
+	return out.Write(w)
+}
+
+func (NativeRenderer) Concat(ctx context.Context, w io.Writer, files []string, data *DocData) error {
+	refs := []pdf.PageRef{}
+	for _, fn := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		d, err := openFile(fn)
+		if err != nil {
+			return err
+		}
+		for i := range d.Pages() {
+			refs = append(refs, pdf.PageRef{Doc: d, Page: i})
+		}
+	}
+	d, err := pdf.Assemble(refs)
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		setDocData(d, data)
+	}
+	return d.Write(w)
+}
+
+func (NativeRenderer) DocData(ctx context.Context, b []byte) (*DocData, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	d, err := pdf.Open(b)
+	if err != nil {
+		return nil, err
+	}
+	pages := d.Pages()
+	data := &DocData{Info: d.InfoMap(), NumberOfPages: len(pages)}
+	for _, b := range d.Outline() {
+		data.Bookmarks = append(data.Bookmarks, Bookmark{b.Title, b.Level, b.Page + 1})
+	}
+	for i, r := range pages {
+		page := d.Dict(r)
+		box := d.MediaBox(page)
+		data.Media = append(data.Media, PageMedia{
+			Number:   i + 1,
+			Rotation: d.Rotation(page),
+			Rect:     PageBox{box[0], box[1], box[2], box[3]},
+		})
+	}
+	return data, nil
+}
+
+func (NativeRenderer) UpdateInfo(ctx context.Context, w io.Writer, b []byte, data *DocData) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	d, err := pdf.Open(b)
+	if err != nil {
+		return err
+	}
+	setDocData(d, data)
+	return d.Write(w)
+}
+
+// setDocData applies the info and bookmarks in data to d.
+func setDocData(d *pdf.Document, data *DocData) {
+	d.SetInfo(data.Info)
+	if len(data.Bookmarks) > 0 {
+		bookmarks := make([]pdf.Bookmark, len(data.Bookmarks))
+		for i, bm := range data.Bookmarks {
+			bookmarks[i] = pdf.Bookmark{Title: bm.Title, Level: bm.Level, Page: bm.PageNumber - 1}
+		}
+		d.SetOutline(bookmarks)
+	}
+}
+
+func (NativeRenderer) Stamp(ctx context.Context, w io.Writer, b, overlay []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	d, err := pdf.Open(b)
+	if err != nil {
+		return err
+	}
+	o, err := pdf.Open(overlay)
+	if err != nil {
+		return err
+	}
+	if err := d.Stamp(o); err != nil {
+		return err
+	}
+	return d.Write(w)
+}
+
+func (NativeRenderer) Burst(ctx context.Context, b []byte, dir string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	d, err := pdf.Open(b)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{}
+	for i := range d.Pages() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		page, err := pdf.Assemble([]pdf.PageRef{{Doc: d, Page: i}})
+		if err != nil {
+			return nil, err
+		}
+		pb, err := page.Bytes()
+		if err != nil {
+			return nil, err
+		}
+		fn := filepath.Join(dir, fmt.Sprintf("p%06d.pdf", i+1))
+		if err := ioutil.WriteFile(fn, pb, 0600); err != nil {
+			return nil, err
+		}
+		files = append(files, fn)
+	}
+	return files, nil
+}
+
+func openFile(path string) (*pdf.Document, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return pdf.Open(b)
+}
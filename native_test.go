@@ -0,0 +1,144 @@
+package pdfhandler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const testTemplate = "./pdf-test/OoPdfFormExample.pdf"
+
+func TestNativeFill(t *testing.T) {
+	r := NativeRenderer{}
+	b, err := output(func(w io.Writer) error {
+		return r.Fill(context.Background(), w, testTemplate, map[string]string{
+			"Family Name Text Box":      "Barsson",
+			"Driving License Check Box": "Yes",
+		}, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := writeTestFile(t, b)
+	defer os.Remove(fn)
+	names, err := r.DumpFields(context.Background(), fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 17 {
+		t.Fatalf("Expected 17 fields, got %d", len(names))
+	}
+
+	b, err = output(func(w io.Writer) error {
+		return r.Fill(context.Background(), w, testTemplate, map[string]string{"Family Name Text Box": "Barsson"}, true)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn = writeTestFile(t, b)
+	defer os.Remove(fn)
+	names, err = r.DumpFields(context.Background(), fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 0 {
+		t.Fatalf("Expected a flattened form, got fields %v", names)
+	}
+}
+
+func TestNativePages(t *testing.T) {
+	r := NativeRenderer{}
+	b, err := output(func(w io.Writer) error {
+		return r.Fill(context.Background(), w, testTemplate, nil, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := writeTestFile(t, b)
+	defer os.Remove(fn)
+	b, err = output(func(w io.Writer) error {
+		return r.Concat(context.Background(), w, []string{fn, fn, fn}, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := r.DocData(context.Background(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.NumberOfPages != 3 || len(d.Media) != 3 {
+		t.Fatalf("Expected 3 pages, got %d", d.NumberOfPages)
+	}
+
+	s, err := output(func(w io.Writer) error {
+		return r.SelectPages(context.Background(), w, b, []PageRange{{0, 2}, {1, 1}})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err = r.DocData(context.Background(), s); err != nil || d.NumberOfPages != 3 {
+		t.Fatalf("Expected 3 pages, got %v %v", d, err)
+	}
+	if err := r.SelectPages(context.Background(), ioutil.Discard, b, []PageRange{{4, 4}}); err != (pageRangeError{PageRange{4, 4}, 3}) {
+		t.Fatalf("Expected an out of bounds range to be rejected, got %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "burst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files, err := r.Burst(context.Background(), b, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("Expected 3 files, got %v", files)
+	}
+}
+
+func TestNativeUpdateInfo(t *testing.T) {
+	r := NativeRenderer{}
+	b, err := output(func(w io.Writer) error {
+		return r.Fill(context.Background(), w, testTemplate, nil, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = output(func(w io.Writer) error {
+		return r.UpdateInfo(context.Background(), w, b, &DocData{
+			Info:      map[string]string{"Title": "Þórsmörk"},
+			Bookmarks: []Bookmark{{"First", 1, 1}},
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := r.DocData(context.Background(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Info["Title"] != "Þórsmörk" {
+		t.Fatalf("Got title %q", d.Info["Title"])
+	}
+}
+
+// output returns what f writes.
+func output(f func(w io.Writer) error) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := f(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeTestFile(t *testing.T, b []byte) string {
+	fn, err := writeTempFile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
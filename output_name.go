@@ -0,0 +1,94 @@
+package pdfhandler
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxOutputNameLength caps the characters of an expanded output name.
+const maxOutputNameLength = 255
+
+var (
+	outputNameAction = regexp.MustCompile(`\{\{(.*?)\}\}`)
+	outputNameField  = regexp.MustCompile(`^\s*(?:\.Fields\.([A-Za-z0-9_]+)|index\s+\.Fields\s+"([^"]*)")\s*$`)
+)
+
+// expandOutputName replaces the {{.Fields.name}} and
+// {{index .Fields "some name"}} actions in text with the values of fields.
+// Other actions are rejected.
+func expandOutputName(text string, fields map[string]string) (string, error) {
+	var err error
+	name := outputNameAction.ReplaceAllStringFunc(text, func(m string) string {
+		sm := outputNameField.FindStringSubmatch(m[2 : len(m)-2])
+		if sm == nil {
+			if err == nil {
+				err = fmt.Errorf("unsupported action %s, only {{.Fields.name}} is allowed", m)
+			}
+			return ""
+		}
+		return fields[sm[1]+sm[2]]
+	})
+	if err != nil {
+		return "", err
+	}
+	if strings.Contains(name, "{{") {
+		return "", fmt.Errorf("unclosed action in %q", text)
+	}
+	return name, nil
+}
+
+// outputName is the name of p in zip output: its expanded OutputName or
+// else its FileName, or the last element of its URL. The name is a slash
+// separated path kept inside the archive.
+func (p PDF) outputName() (string, error) {
+	name := p.FileName
+	if name == "" && p.URL != "" {
+		if u, err := url.Parse(p.URL); err == nil {
+			name = path.Base(u.Path)
+		}
+	}
+	if p.OutputName != "" {
+		var err error
+		name, err = expandOutputName(p.OutputName, p.Fields)
+		if err != nil {
+			return "", fmt.Errorf("Invalid output_name: %s", err)
+		}
+	}
+	name = path.Clean("/" + strings.Replace(name, "\\", "/", -1))[1:]
+	if n := utf8.RuneCountInString(name); n > maxOutputNameLength {
+		return "", fmt.Errorf("Output name is %d characters long, exceeding the limit of %d characters", n, maxOutputNameLength)
+	}
+	if name == "" {
+		name = "document.pdf"
+	}
+	return name, nil
+}
+
+// checkOutputNames validates the output names of pdfs.
+func checkOutputNames(pdfs []PDF) error {
+	for _, p := range pdfs {
+		if _, err := p.outputName(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entryNames hands out unique zip entry names, numbering repeats of a
+// name like "name (2).pdf".
+type entryNames map[string]bool
+
+func (e entryNames) unique(name string) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	n := name
+	for i := 2; e[n]; i++ {
+		n = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	e[n] = true
+	return n
+}
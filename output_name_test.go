@@ -0,0 +1,96 @@
+package pdfhandler
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutputName(t *testing.T) {
+	fields := map[string]string{"invoice_no": "1234"}
+	for _, c := range []struct {
+		p        PDF
+		expected string
+	}{
+		{PDF{FileName: "invoice.pdf"}, "invoice.pdf"},
+		{PDF{}, "document.pdf"},
+		{PDF{FileName: "invoice.pdf", Fields: fields, OutputName: "{{.Fields.invoice_no}}.pdf"}, "1234.pdf"},
+		{PDF{Fields: fields, OutputName: "2019/invoices/{{.Fields.invoice_no}}.pdf"}, "2019/invoices/1234.pdf"},
+		{PDF{OutputName: `..\..\etc/passwd`}, "etc/passwd"},
+		{PDF{OutputName: "/abs/./name.pdf"}, "abs/name.pdf"},
+		{PDF{Fields: map[string]string{"Invoice No": "7"}, OutputName: `{{ index .Fields "Invoice No" }}-{{.Fields.missing}}.pdf`}, "7-.pdf"},
+	} {
+		name, err := c.p.outputName()
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, name)
+	}
+	for _, name := range []string{
+		"{{.Fields",
+		`{{printf "%s" .Fields.invoice_no}}.pdf`,
+		"{{range .Fields}}x{{end}}",
+		"{{.FileName}}",
+		strings.Repeat("x", 256),
+	} {
+		_, err := PDF{Fields: fields, OutputName: name}.outputName()
+		assert.Error(t, err, name)
+	}
+	_, err := PDF{Fields: map[string]string{"x": strings.Repeat("x", 300)}, OutputName: "{{.Fields.x}}"}.outputName()
+	assert.EqualError(t, err, "Output name is 300 characters long, exceeding the limit of 255 characters")
+}
+
+func TestEntryNames(t *testing.T) {
+	names := entryNames{}
+	assert.Equal(t, "a.pdf", names.unique("a.pdf"))
+	assert.Equal(t, "a (2).pdf", names.unique("a.pdf"))
+	assert.Equal(t, "a (3).pdf", names.unique("a.pdf"))
+	assert.Equal(t, "b/a.pdf", names.unique("b/a.pdf"))
+	assert.Equal(t, "readme (2)", names.unique("readme (2)"))
+	assert.Equal(t, "readme", names.unique("readme"))
+	assert.Equal(t, "readme (3)", names.unique("readme"))
+}
+
+// zipNames returns the names of the entries of a zip file.
+func zipNames(t *testing.T, b []byte) []string {
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestPostMultiZipDuplicateNames(t *testing.T) {
+	SetLogger(&testLogger{t})
+	resp, b := postJSON(t, pdfHandler, "application/zip", multi)
+	requireOK(t, resp, b)
+	assert.Equal(t, []string{"OoPdfFormExample.pdf", "OoPdfFormExample (2).pdf"}, zipNames(t, b))
+}
+
+func TestPostMultiZipOutputName(t *testing.T) {
+	SetLogger(&testLogger{t})
+	pdfs := []PDF{}
+	for _, name := range []string{"Barsson", "Jonsson", "Barsson"} {
+		p := single
+		p.Fields = map[string]string{"Family Name Text Box": name}
+		p.OutputName = `forms/{{index .Fields "Family Name Text Box"}}.pdf`
+		pdfs = append(pdfs, p)
+	}
+	resp, b := postJSON(t, pdfHandler, "application/zip", pdfs)
+	requireOK(t, resp, b)
+	assert.Equal(t, []string{"forms/Barsson.pdf", "forms/Jonsson.pdf", "forms/Barsson (2).pdf"}, zipNames(t, b))
+}
+
+func TestPostInvalidOutputName(t *testing.T) {
+	SetLogger(&testLogger{t})
+	p := single
+	p.OutputName = "{{.Fields"
+	resp, _ := postJSON(t, pdfHandler, "application/zip", []PDF{p})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
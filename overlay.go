@@ -0,0 +1,132 @@
+package pdfhandler
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/StefanKjartansson/pdfhandler/internal/pdf"
+)
+
+type align int
+
+const (
+	alignCenter align = iota
+	alignLeft
+	alignRight
+)
+
+// textMark is a line of text placed on an overlay page. The text is
+// vertically centered on X, Y, aligned horizontally to it by Align and
+// rotated Angle degrees counter clockwise around it.
+type textMark struct {
+	Text    string
+	X, Y    float64
+	Size    float64
+	Angle   float64
+	Opacity float64
+	Gray    float64
+	Align   align
+}
+
+type overlayPage struct {
+	Box   PageBox
+	Marks []textMark
+}
+
+func pdfString(b []byte) string {
+	var buf bytes.Buffer
+	buf.WriteByte('(')
+	for _, c := range b {
+		switch c {
+		case '(', ')', '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	buf.WriteByte(')')
+	return buf.String()
+}
+
+func num(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func (m textMark) content(gs string) []byte {
+	text := pdf.WinAnsi(m.Text)
+	rad := m.Angle * math.Pi / 180
+	cos, sin := math.Cos(rad), math.Sin(rad)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "q /%s gs %s g BT /F1 %s Tf ", gs, num(m.Gray), num(m.Size))
+	fmt.Fprintf(&buf, "%.4f %.4f %.4f %.4f %s %s Tm ", cos, sin, -sin, cos, num(m.X), num(m.Y))
+	x := 0.0
+	switch m.Align {
+	case alignCenter:
+		x = -pdf.HelveticaTextWidth(text, m.Size) / 2
+	case alignRight:
+		x = -pdf.HelveticaTextWidth(text, m.Size)
+	}
+	fmt.Fprintf(&buf, "%.2f %.2f Td %s Tj ET Q\n", x, -m.Size*0.35, pdfString(text))
+	return buf.Bytes()
+}
+
+// overlayPDF generates a pdf with one page per overlay page, each sized to
+// its box and carrying its marks, suitable for use with pdftk multistamp.
+func overlayPDF(pages []overlayPage) ([]byte, error) {
+	var buf bytes.Buffer
+	offsets := []int{}
+	obj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	kids := bytes.NewBufferString("")
+	for i := range pages {
+		fmt.Fprintf(kids, "%d 0 R ", 4+i*2)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [ %s] /Count %d >>", kids.String(), len(pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	for i, p := range pages {
+		states := bytes.NewBufferString("")
+		var content bytes.Buffer
+		for j, m := range p.Marks {
+			name := fmt.Sprintf("GS%d", j)
+			fmt.Fprintf(states, "/%s << /Type /ExtGState /ca %s /CA %s >> ", name, num(m.Opacity), num(m.Opacity))
+			content.Write(m.content(name))
+		}
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [%s %s %s %s] "+
+			"/Resources << /Font << /F1 3 0 R >> /ExtGState << %s>> >> /Contents %d 0 R >>",
+			num(p.Box.X1), num(p.Box.Y1), num(p.Box.X2), num(p.Box.Y2), states.String(), 5+i*2))
+
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		if _, err := zw.Write(content.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", len(offsets), z.Len())
+		buf.Write(z.Bytes())
+		buf.WriteString("\nendstream\nendobj\n")
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,114 @@
+package pdfhandler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultPageNumberFormat   = "Page {page} of {pages}"
+	defaultPageNumberPosition = "bottom-center"
+	defaultPageNumberSize     = 10
+	pageNumberMargin          = 24
+	maxPageNumberFormatLength = 100
+)
+
+// PageNumbers stamps a page number on every page of the final output.
+// In Format {page} is replaced by the page number and {pages} by the
+// total number of pages. Position is one of top-left, top-center,
+// top-right, bottom-left, bottom-center or bottom-right.
+type PageNumbers struct {
+	Format   string  `json:"format,omitempty"`
+	Position string  `json:"position,omitempty"`
+	Size     float64 `json:"size,omitempty"`
+}
+
+// place returns where on box a page number goes for the given position.
+func place(position string, box PageBox) (x, y float64, a align, err error) {
+	vertical, horizontal := position, ""
+	if i := strings.Index(position, "-"); i >= 0 {
+		vertical, horizontal = position[:i], position[i+1:]
+	}
+	switch vertical {
+	case "top":
+		y = box.Y2 - pageNumberMargin
+	case "bottom":
+		y = box.Y1 + pageNumberMargin
+	default:
+		return 0, 0, 0, fmt.Errorf("Invalid page number position %q", position)
+	}
+	switch horizontal {
+	case "left":
+		x, a = box.X1+pageNumberMargin, alignLeft
+	case "center":
+		x, a = box.X1+box.width()/2, alignCenter
+	case "right":
+		x, a = box.X2-pageNumberMargin, alignRight
+	default:
+		return 0, 0, 0, fmt.Errorf("Invalid page number position %q", position)
+	}
+	return x, y, a, nil
+}
+
+// check validates the settings of pn.
+func (pn PageNumbers) check() error {
+	if n := utf8.RuneCountInString(pn.Format); n > maxPageNumberFormatLength {
+		return fmt.Errorf("Page number format is %d characters long, exceeding the limit of %d characters", n, maxPageNumberFormatLength)
+	}
+	if pn.Position != "" {
+		if _, _, _, err := place(pn.Position, PageBox{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pn PageNumbers) marks(media []PageMedia) ([]overlayPage, error) {
+	format, position, size := pn.Format, pn.Position, pn.Size
+	if format == "" {
+		format = defaultPageNumberFormat
+	}
+	if position == "" {
+		position = defaultPageNumberPosition
+	}
+	if size <= 0 {
+		size = defaultPageNumberSize
+	}
+	pages := make([]overlayPage, len(media))
+	for i, m := range media {
+		x, y, a, err := place(position, m.Rect)
+		if err != nil {
+			return nil, err
+		}
+		text := strings.NewReplacer("{page}", strconv.Itoa(i+1), "{pages}", strconv.Itoa(len(media))).Replace(format)
+		pages[i] = overlayPage{
+			Box: m.Rect,
+			Marks: []textMark{{
+				Text:    text,
+				X:       x,
+				Y:       y,
+				Size:    size,
+				Opacity: 1,
+				Align:   a,
+			}},
+		}
+	}
+	return pages, nil
+}
+
+// stamp numbers the pages of the pdf in b.
+func (pn PageNumbers) stamp(ctx context.Context, r Renderer, w io.Writer, b []byte) error {
+	d, err := r.DocData(ctx, b)
+	if err != nil {
+		return err
+	}
+	pages, err := pn.marks(d.Media)
+	if err != nil {
+		return err
+	}
+	return stampOverlay(ctx, r, w, b, pages)
+}
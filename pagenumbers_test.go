@@ -0,0 +1,40 @@
+package pdfhandler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPageNumberMarks(t *testing.T) {
+	media := []PageMedia{
+		{Number: 1, Rect: PageBox{0, 0, 595, 842}},
+		{Number: 2, Rect: PageBox{0, 0, 612, 792}},
+	}
+	pages, err := PageNumbers{Format: "{page}/{pages} {{.Page}}", Position: "top-right"}.marks(media)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := pages[1].Marks[0]
+	if m.Text != "2/2 {{.Page}}" || m.X != 612-pageNumberMargin || m.Y != 792-pageNumberMargin || m.Align != alignRight {
+		t.Fatalf("Unexpected mark %+v", m)
+	}
+	pages, err = PageNumbers{}.marks(media)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = pages[0].Marks[0]
+	if m.Text != "Page 1 of 2" || m.X != 595.0/2 || m.Size != defaultPageNumberSize {
+		t.Fatalf("Unexpected mark %+v", m)
+	}
+	for _, position := range []string{"middle", "top", "bottom-middle"} {
+		if err := (PageNumbers{Position: position}).check(); err == nil {
+			t.Fatalf("Expected position %q to be rejected", position)
+		}
+	}
+	if err := (PageNumbers{Format: strings.Repeat("{page}", 20)}).check(); err == nil {
+		t.Fatal("Expected an over long format to be rejected")
+	}
+	if err := (PageNumbers{Format: "{page}", Position: "top-left"}).check(); err != nil {
+		t.Fatal(err)
+	}
+}
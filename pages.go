@@ -0,0 +1,85 @@
+package pdfhandler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PageRange is an inclusive range of page numbers. A page number of 0
+// stands for the last page of the document.
+type PageRange struct {
+	From, To int
+}
+
+func pageToken(n int) string {
+	if n == 0 {
+		return "end"
+	}
+	return strconv.Itoa(n)
+}
+
+// String returns the range in pdftk's page range syntax.
+func (r PageRange) String() string {
+	if r.From == r.To {
+		return pageToken(r.From)
+	}
+	return pageToken(r.From) + "-" + pageToken(r.To)
+}
+
+func parsePage(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "end" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("Invalid page %q", s)
+	}
+	return n, nil
+}
+
+// parsePageSpec parses a comma separated list of pages and page ranges,
+// such as "1-3,5,end". Pages are emitted in the order given, so the spec
+// can also reorder or repeat pages.
+func parsePageSpec(spec string) ([]PageRange, error) {
+	ranges := []PageRange{}
+	for _, part := range strings.Split(spec, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		from, err := parsePage(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		to := from
+		if len(bounds) == 2 {
+			to, err = parsePage(bounds[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		ranges = append(ranges, PageRange{from, to})
+	}
+	return ranges, nil
+}
+
+// pageRangeError reports a page range past the end of a document. It is
+// the client's error, not a failure to render.
+type pageRangeError struct {
+	r PageRange
+	n int
+}
+
+func (e pageRangeError) Error() string {
+	return fmt.Sprintf("Page range %s out of bounds, document has %d pages", e.r, e.n)
+}
+
+// checkPageRanges fails with a pageRangeError unless every range lies
+// within a document of n pages.
+func checkPageRanges(ranges []PageRange, n int) error {
+	for _, r := range ranges {
+		if r.From > n || r.To > n {
+			return pageRangeError{r, n}
+		}
+	}
+	return nil
+}
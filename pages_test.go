@@ -0,0 +1,37 @@
+package pdfhandler
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePageSpec(t *testing.T) {
+	for spec, expected := range map[string][]PageRange{
+		"1-3,5,end": {{1, 3}, {5, 5}, {0, 0}},
+		"end-1":     {{0, 1}},
+		" 2 , 1 ":   {{2, 2}, {1, 1}},
+		"3-end":     {{3, 0}},
+	} {
+		ranges, err := parsePageSpec(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ranges, expected) {
+			t.Fatalf("Expected %q to parse as %v, got %v", spec, expected, ranges)
+		}
+	}
+	for _, spec := range []string{"", "0", "1-", "a", "1,,2", "-2"} {
+		if _, err := parsePageSpec(spec); err == nil {
+			t.Fatalf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestPageRangeString(t *testing.T) {
+	if s := (PageRange{3, 0}).String(); s != "3-end" {
+		t.Fatalf("Got %q", s)
+	}
+	if s := (PageRange{5, 5}).String(); s != "5" {
+		t.Fatalf("Got %q", s)
+	}
+}
@@ -1,18 +1,22 @@
 package pdfhandler
 
 import (
-	"archive/zip"
 	"bufio"
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -23,6 +27,9 @@ import (
 var (
 	acceptedContentTypes = []string{
 		"application/zip",
+		"application/x-tar",
+		"application/gzip",
+		"multipart/mixed",
 		"application/pdf",
 	}
 	logger StdLogger
@@ -54,96 +61,520 @@ func SetLogger(l StdLogger) {
 }
 
 type PDFHandler struct {
-	filePath string
+	filePath       string
+	renderer       Renderer
+	renderTimeout  time.Duration
+	requestTimeout time.Duration
+	concurrency    int
+	queueTimeout   time.Duration
+	pool           *pool
+	limits         limits
+
+	templateHosts      []string
+	templateTimeout    time.Duration
+	maxTemplateBytes   int64
+	templateCacheBytes int64
+	templates          *remoteTemplates
+
+	jobTTL    time.Duration
+	maxJobs   int
+	jobsPath  string
+	asyncJobs *jobStore
+
+	webhookSecret  string
+	webhookHosts   []string
+	webhookRetries int
+	webhookBackoff time.Duration
+	webhooks       *webhooks
+	publicURL      string
+}
+
+const defaultQueueTimeout = 30 * time.Second
+
+// Option configures a PDFHandler.
+type Option func(*PDFHandler)
+
+// WithRenderer makes the handler use r instead of pdftk. Pass
+// NativeRenderer{} to run on hosts without pdftk installed.
+func WithRenderer(r Renderer) Option {
+	return func(ph *PDFHandler) {
+		ph.renderer = r
+	}
+}
+
+// WithRenderTimeout limits the time spent rendering each document, and
+// concatenating the documents of a list. Zero means no limit.
+func WithRenderTimeout(d time.Duration) Option {
+	return func(ph *PDFHandler) {
+		ph.renderTimeout = d
+	}
+}
+
+// WithRequestTimeout limits the time spent on a request, and on rendering
+// a job. Zero means no limit.
+func WithRequestTimeout(d time.Duration) Option {
+	return func(ph *PDFHandler) {
+		ph.requestTimeout = d
+	}
+}
+
+// WithConcurrency limits the number of documents rendered at once, over
+// all requests, to n. The default is the number of CPUs.
+func WithConcurrency(n int) Option {
+	return func(ph *PDFHandler) {
+		ph.concurrency = n
+	}
+}
+
+// WithQueueTimeout sets how long a request waits for rendering to start
+// when the handler is busy before it is turned away with 503 Service
+// Unavailable. The default is 30 seconds.
+func WithQueueTimeout(d time.Duration) Option {
+	return func(ph *PDFHandler) {
+		ph.queueTimeout = d
+	}
+}
+
+// WithMaxBodyBytes limits the size of a request body. Larger requests are
+// answered with 413 Request Entity Too Large.
+func WithMaxBodyBytes(n int64) Option {
+	return func(ph *PDFHandler) {
+		ph.limits.maxBodyBytes = n
+	}
+}
+
+// WithMaxDocuments limits the number of documents in a request, counting
+// each of their copies. Larger batches are answered with 413 Request
+// Entity Too Large.
+func WithMaxDocuments(n int) Option {
+	return func(ph *PDFHandler) {
+		ph.limits.maxDocuments = n
+	}
+}
+
+// WithMaxContentBytes limits the decoded size of a document's content.
+// Larger documents are answered with 413 Request Entity Too Large.
+func WithMaxContentBytes(n int) Option {
+	return func(ph *PDFHandler) {
+		ph.limits.maxContentBytes = n
+	}
+}
+
+// WithMaxFieldLength limits the number of characters in a field value.
+// Longer values are answered with 400 Bad Request.
+func WithMaxFieldLength(n int) Option {
+	return func(ph *PDFHandler) {
+		ph.limits.maxFieldLength = n
+	}
+}
+
+// WithTemplateHosts allows documents to name a template by url, to be
+// downloaded from one of hosts. A host without a port allows any port.
+func WithTemplateHosts(hosts ...string) Option {
+	return func(ph *PDFHandler) {
+		ph.templateHosts = append(ph.templateHosts, hosts...)
+	}
+}
+
+// WithTemplateTimeout limits the time spent downloading a template, 30
+// seconds by default.
+func WithTemplateTimeout(d time.Duration) Option {
+	return func(ph *PDFHandler) {
+		ph.templateTimeout = d
+	}
+}
+
+// WithMaxTemplateBytes limits the size of a downloaded template, 10 MiB
+// by default.
+func WithMaxTemplateBytes(n int64) Option {
+	return func(ph *PDFHandler) {
+		ph.maxTemplateBytes = n
+	}
+}
+
+// WithTemplateCacheBytes limits the total size of the downloaded templates
+// kept for revalidation, 64 MiB by default. The least recently used are
+// dropped first, and 0 disables the cache.
+func WithTemplateCacheBytes(n int64) Option {
+	return func(ph *PDFHandler) {
+		ph.templateCacheBytes = n
+	}
+}
+
+// WithJobTTL sets how long a finished job and its output are kept, an
+// hour by default.
+func WithJobTTL(d time.Duration) Option {
+	return func(ph *PDFHandler) {
+		ph.jobTTL = d
+	}
+}
+
+// WithMaxJobs limits the number of jobs held at a time, running or kept
+// after finishing, 1000 by default. Further jobs are answered with 503
+// Service Unavailable.
+func WithMaxJobs(n int) Option {
+	return func(ph *PDFHandler) {
+		ph.maxJobs = n
+	}
+}
+
+// WithJobsPath sets the path jobs are served at, /jobs by default. A
+// handler mounted below a prefix without http.StripPrefix includes the
+// prefix, e.g. "/pdf/jobs".
+func WithJobsPath(p string) Option {
+	return func(ph *PDFHandler) {
+		ph.jobsPath = "/" + strings.Trim(p, "/")
+	}
+}
+
+// WithWebhookSecret enables callback_url on jobs, signing the events with
+// secret.
+func WithWebhookSecret(secret string) Option {
+	return func(ph *PDFHandler) {
+		ph.webhookSecret = secret
+	}
+}
+
+// WithWebhookHosts allows callbacks to hosts matching one of patterns,
+// e.g. "hooks.example.com" or "*.example.com". A pattern without a port
+// allows any port.
+func WithWebhookHosts(patterns ...string) Option {
+	return func(ph *PDFHandler) {
+		ph.webhookHosts = append(ph.webhookHosts, patterns...)
+	}
 }
 
-func New(path string) (*PDFHandler, error) {
+// WithPublicURL sets the url the handler is reached at from outside, e.g.
+// "https://pdf.example.com", which the links of webhook events start with.
+// Without it the links are paths.
+func WithPublicURL(u string) Option {
+	return func(ph *PDFHandler) {
+		ph.publicURL = strings.TrimSuffix(u, "/")
+	}
+}
+
+// WithWebhookRetries sets how often a failed event delivery is retried, 5
+// times by default. The wait between retries starts at the backoff, a
+// second by default, and doubles every time.
+func WithWebhookRetries(n int, backoff time.Duration) Option {
+	return func(ph *PDFHandler) {
+		ph.webhookRetries = n
+		ph.webhookBackoff = backoff
+	}
+}
+
+func New(path string, opts ...Option) (*PDFHandler, error) {
 	_, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
-	return &PDFHandler{path}, nil
+	ph := &PDFHandler{
+		filePath:     path,
+		renderer:     PdftkRenderer{},
+		concurrency:  runtime.NumCPU(),
+		queueTimeout: defaultQueueTimeout,
+
+		templateTimeout:    defaultTemplateTimeout,
+		maxTemplateBytes:   defaultMaxTemplateBytes,
+		templateCacheBytes: defaultTemplateCacheBytes,
+
+		jobTTL:   defaultJobTTL,
+		maxJobs:  defaultMaxJobs,
+		jobsPath: defaultJobsPath,
+
+		webhookRetries: defaultWebhookRetries,
+		webhookBackoff: defaultWebhookBackoff,
+	}
+	for _, opt := range opts {
+		opt(ph)
+	}
+	ph.pool = newPool(ph.concurrency, ph.queueTimeout)
+	ph.templates = newRemoteTemplates(ph.templateHosts, ph.templateTimeout, ph.maxTemplateBytes, ph.templateCacheBytes)
+	ph.asyncJobs = newJobStore(ph.jobTTL, ph.maxJobs)
+	ph.webhooks = newWebhooks(ph.webhookSecret, ph.webhookHosts, ph.webhookRetries, ph.webhookBackoff)
+	return ph, nil
 }
 
-func (ph PDFHandler) multi(mimetype string, pdfs []PDF, w http.ResponseWriter) error {
+// job is a file of multi's output.
+type job struct {
+	Pdf   PDF
+	File  string
+	Pages int
+	// Name is the name of the file in zip output.
+	Name string
+	// Index is the position of the document in the request.
+	Index int
+}
+
+// jobs renders p, the idx-th document of a list, into dir and returns
+// the files it contributes to the output.
+func (ph PDFHandler) jobs(ctx context.Context, dir string, idx int, p PDF, mimetype string, opts Options) ([]job, error) {
+	tmpfn := filepath.Join(dir, fmt.Sprintf("%d.pdf", idx))
+	logger.Debugf("Rendering %s/%s to %s", ph.filePath, p.FileName, tmpfn)
+	p, err := ph.templates.resolve(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	if err := renderFile(ctx, ph.renderer, ph.filePath, p, tmpfn); err != nil {
+		return nil, err
+	}
+	name, err := p.outputName()
+	if err != nil {
+		return nil, err
+	}
+	jobs := []job{}
+	if opts.burst {
+		b, err := ioutil.ReadFile(tmpfn)
+		if err != nil {
+			return nil, err
+		}
+		files, err := ph.renderer.Burst(ctx, b, filepath.Join(dir, strconv.Itoa(idx)))
+		if err != nil {
+			return nil, err
+		}
+		for c := 0; c < p.copies(); c++ {
+			for n, fn := range files {
+				jobs = append(jobs, job{p, fn, 1, pageFileName(name, n+1), idx})
+			}
+		}
+		return jobs, nil
+	}
+	pages := 0
+	if mimetype == "application/pdf" || opts.Manifest {
+		b, err := ioutil.ReadFile(tmpfn)
+		if err != nil {
+			return nil, err
+		}
+		d, err := ph.renderer.DocData(ctx, b)
+		if err != nil {
+			return nil, err
+		}
+		pages = d.NumberOfPages
+	}
+	for c := 0; c < p.copies(); c++ {
+		jobs = append(jobs, job{p, tmpfn, pages, name, idx})
+	}
+	return jobs, nil
+}
+
+// rendered are the jobs of the document at idx of a batch, none if it
+// failed.
+type rendered struct {
+	idx  int
+	jobs []job
+}
+
+// ordered calls f with the jobs of a batch in request order, each document
+// as soon as it and all documents before it are rendered.
+func ordered(ch <-chan rendered, f func(job) error) error {
+	pending := map[int][]job{}
+	next := 0
+	for r := range ch {
+		pending[r.idx] = r.jobs
+		for {
+			jobs, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			for _, j := range jobs {
+				if err := f(j); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (ph PDFHandler) multi(ctx context.Context, mimetype string, pdfs []PDF, opts Options, w io.Writer) error {
 	dir, err := ioutil.TempDir("", "workpath")
 	if err != nil {
 		return err
 	}
-	defer os.RemoveAll(dir)
+	ctx, cancel := context.WithCancel(ctx)
+	ch := make(chan rendered)
+	finished := make(chan struct{})
+	// Stop the renders and wait for them before removing their files.
+	defer func() {
+		cancel()
+		<-finished
+		os.RemoveAll(dir)
+	}()
 
-	type job struct {
-		Pdf  PDF
-		File string
-		Body []byte
+	var once sync.Once
+	var failed error
+	fail := func(err error) {
+		once.Do(func() {
+			failed = err
+			cancel()
+		})
 	}
-	ch := make(chan job)
+	var mu sync.Mutex
+	failures := []failure{}
 
+	// Documents are started as render slots become free.
 	go func() {
+		defer close(finished)
+		defer close(ch)
 		var wg sync.WaitGroup
+		defer wg.Wait()
 		for idx, p := range pdfs {
+			acquire := ph.pool.acquire
+			if idx == 0 {
+				acquire = func(ctx context.Context) error { return ph.admit(ctx, opts) }
+			}
+			if err := acquire(ctx); err != nil {
+				if _, ok := err.(saturatedError); ok {
+					fail(err)
+				}
+				return
+			}
 			wg.Add(1)
 			go func(idx int, p PDF) {
 				defer wg.Done()
-				tmpfn := filepath.Join(dir, fmt.Sprintf("%d.pdf", idx))
-				logger.Debugf("Rendering %s/%s to %s", ph.filePath, p.FileName, tmpfn)
-				b, err := p.render(ph.filePath)
+				var jobs []job
+				err := withTimeout(ctx, ph.renderTimeout, "Rendering "+p.FileName, func(ctx context.Context) error {
+					var err error
+					jobs, err = ph.jobs(ctx, dir, idx, p, mimetype, opts)
+					return err
+				})
+				ph.pool.release()
 				if err != nil {
-					return
+					if ctx.Err() != nil {
+						// The request was cancelled, not the document.
+						return
+					}
+					logger.Errorf("Rendering document %d (%s): %q", idx, p.FileName, err.Error())
+					if !opts.lenient() {
+						fail(documentError{idx, p.FileName, err})
+						return
+					}
+					mu.Lock()
+					failures = append(failures, failure{idx, p.FileName, err.Error()})
+					mu.Unlock()
+				}
+				opts.rendered()
+				select {
+				case ch <- rendered{idx, jobs}:
+				case <-ctx.Done():
 				}
-				ioutil.WriteFile(tmpfn, b, 0777)
-				ch <- job{p, tmpfn, b}
 			}(idx, p)
 		}
-		wg.Wait()
-		close(ch)
 	}()
 
+	// done reports why the renders stopped early, if they did.
+	done := func() error {
+		if failed != nil {
+			return failed
+		}
+		return ctx.Err()
+	}
+
 	switch mimetype {
 	case "application/pdf":
-		cmd := exec.Command("pdftk")
+		jobs := []job{}
+		if err := ordered(ch, func(j job) error {
+			jobs = append(jobs, j)
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := done(); err != nil {
+			return err
+		}
+		if len(jobs) == 0 && len(failures) > 0 {
+			return errors.New("All documents failed to render")
+		}
 		files := []string{}
-		for j := range ch {
+		bookmarks := []Bookmark{}
+		page := 1
+		for _, j := range jobs {
 			files = append(files, j.File)
+			bookmarks = append(bookmarks, Bookmark{j.Pdf.title(), 1, page})
+			page += j.Pages
 		}
-		sort.Strings(files)
-		for _, f := range files {
-			cmd.Args = append(cmd.Args, f)
+		if err := ph.pool.acquire(ctx); err != nil {
+			return err
 		}
-		cmd.Args = append(cmd.Args, "cat")
-		cmd.Args = append(cmd.Args, "output")
-		cmd.Args = append(cmd.Args, "-")
-		logger.Debugf("Executing pdftk: %q", strings.Join(cmd.Args, " "))
-		var out bytes.Buffer
-		cmd.Stdout = &out
-		var t bytes.Buffer
-		cmd.Stderr = &t
-		err = cmd.Run()
+		defer ph.pool.release()
+		return withTimeout(ctx, ph.renderTimeout, "Concatenating documents", func(ctx context.Context) error {
+			return pipe(ctx, w, opts.concatSteps(ph.renderer, files, bookmarks)...)
+		})
+	default:
+		a, err := newArchiveWriter(mimetype, w, opts.boundary)
 		if err != nil {
-			return errors.New(t.String())
+			return err
 		}
-		w.Write(out.Bytes())
-		return nil
-	case "application/zip":
-		zw := zip.NewWriter(w)
-		for j := range ch {
-			header := &zip.FileHeader{
-				Name:   j.Pdf.FileName,
-				Method: zip.Deflate,
-			}
-			header.SetModTime(time.Now())
-			f, err := zw.CreateHeader(header)
+		names := entryNames{}
+		if opts.lenient() {
+			names.unique("errors.json")
+		}
+		if opts.Manifest {
+			names.unique("manifest.json")
+		}
+		m := manifest{RequestID: opts.requestID, Documents: []manifestEntry{}}
+		err = ordered(ch, func(j job) error {
+			name := names.unique(j.Name)
+			st, err := os.Stat(j.File)
 			if err != nil {
 				return err
 			}
-			_, err = f.Write(j.Body)
+			f, err := a.create(name, st.Size())
 			if err != nil {
 				return err
 			}
+			d := newDigestWriter(f)
+			if err := copyFile(d, j.File); err != nil {
+				return err
+			}
+			m.Documents = append(m.Documents, manifestEntry{j.Index, j.Pdf.template(), name, j.Pages, d.size, d.sum()})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if err := done(); err != nil {
+			return err
 		}
-		return zw.Close()
+		if opts.lenient() {
+			sort.Slice(failures, func(i, j int) bool { return failures[i].Index < failures[j].Index })
+			if err := writeJSONEntry(a, "errors.json", failures); err != nil {
+				return err
+			}
+		}
+		if opts.Manifest {
+			if err := writeJSONEntry(a, "manifest.json", m); err != nil {
+				return err
+			}
+		}
+		return a.Close()
 	}
-	return nil
+}
+
+// renderFile renders p into the file fn.
+func renderFile(ctx context.Context, r Renderer, rootPath string, p PDF, fn string) error {
+	f, err := os.Create(fn)
+	if err != nil {
+		return err
+	}
+	if err := p.render(ctx, r, rootPath, f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// copyFile streams the contents of the file fn to w.
+func copyFile(w io.Writer, fn string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
 }
 
 func (p PDFHandler) get(w http.ResponseWriter, req *http.Request) {
@@ -152,31 +583,48 @@ func (p PDFHandler) get(w http.ResponseWriter, req *http.Request) {
 		Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	ctx := req.Context()
 	ch := make(chan PDF)
+	var admitErr error
 
 	go func() {
 		var wg sync.WaitGroup
+		defer close(ch)
+		defer wg.Wait()
+		admitted := false
 		for _, file := range files {
 			if !strings.HasSuffix(file.Name(), ".pdf") {
 				continue
 			}
+			acquire := p.pool.acquire
+			if !admitted {
+				acquire = p.pool.admit
+			}
+			if err := acquire(ctx); err != nil {
+				admitErr = err
+				return
+			}
+			admitted = true
 			wg.Add(1)
 			go func(fp string) {
-				p, err := readFields(p.filePath, fp)
+				defer wg.Done()
+				f, err := readFields(ctx, p.renderer, p.filePath, fp)
+				p.pool.release()
 				if err == nil {
-					ch <- *p
+					ch <- *f
 				}
-				defer wg.Done()
 			}(file.Name())
 		}
-		wg.Wait()
-		close(ch)
 	}()
 
 	pdfs := []PDF{}
 	for p := range ch {
 		pdfs = append(pdfs, p)
 	}
+	if admitErr != nil {
+		p.fail(w, admitErr)
+		return
+	}
 
 	enc := json.NewEncoder(w)
 	err = enc.Encode(pdfs)
@@ -187,72 +635,240 @@ func (p PDFHandler) get(w http.ResponseWriter, req *http.Request) {
 
 }
 
-func (p PDFHandler) post(w http.ResponseWriter, req *http.Request) {
-	ct := req.Header.Get("Content-Type")
-	if ct != "application/json" {
-		Error(w, "Invalid Content-Type", http.StatusBadRequest)
-		return
+// task is a decoded POST: the documents to render and how to send them.
+type task struct {
+	request
+	accept      string
+	contentType string
+	filename    string
+}
+
+// documents is the number of documents of t.
+func (t *task) documents() int {
+	if t.Documents != nil {
+		return len(t.Documents)
+	}
+	return 1
+}
+
+// setHeaders sets the headers of a response carrying the output of t.
+func (t *task) setHeaders(h http.Header) {
+	h.Set("X-Request-ID", t.requestID)
+	h.Set("Content-Type", t.contentType)
+	if t.boundary == "" {
+		h.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", t.filename))
+	}
+}
+
+// decodePost decodes and validates a POST of documents to render.
+func (p PDFHandler) decodePost(req *http.Request, burst bool) (*task, error) {
+	ct, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if ct != "application/json" && ct != "multipart/form-data" {
+		return nil, errors.New("Invalid Content-Type")
 	}
 
 	ac := req.Header.Get("Accept")
 	if !stringInSlice(ac, acceptedContentTypes) {
-		Error(w, "Invalid Accept header", http.StatusBadRequest)
-		return
+		return nil, errors.New("Invalid Accept header")
 	}
 
-	filename := req.Header.Get("X-Filename")
-	if filename == "" {
+	if burst && !isArchive(ac) {
+		return nil, errors.New("Burst output requires an archive Accept header, e.g. application/zip")
+	}
+
+	t := &task{accept: ac, contentType: ac}
+	var err error
+	body := p.limits.body(req.Body)
+	if ct == "multipart/form-data" {
+		t.request, err = readForm(multipart.NewReader(body, params["boundary"]))
+	} else {
+		t.request, err = decodeRequest(body)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Documents != nil && len(t.Documents) == 0 {
+		return nil, errors.New("Request has no documents")
+	}
+
+	t.burst = burst
+	t.requestID = req.Header.Get("X-Request-ID")
+	if t.requestID == "" {
+		t.requestID = uuid.NewV4().String()
+	}
+	t.filename = req.Header.Get("X-Filename")
+	if t.filename == "" {
 		uid := uuid.NewV4()
-		filename = uid.String()
+		t.filename = uid.String()
 	}
-	if strings.HasSuffix(ac, "zip") {
-		filename += ".zip"
+	if isArchive(ac) {
+		t.filename += archiveExtensions[ac]
 	} else if strings.HasSuffix(ac, "pdf") {
-		filename += ".pdf"
+		t.filename += ".pdf"
+	}
+	if ac == "multipart/mixed" {
+		t.boundary = multipart.NewWriter(nil).Boundary()
+		t.contentType = mime.FormatMediaType(ac, map[string]string{"boundary": t.boundary})
 	}
 
-	r := bufio.NewReader(req.Body)
-	dec := json.NewDecoder(r)
-	ch, _ := r.Peek(1)
-
-	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
-	w.Header().Set("Content-Type", ac)
+	if t.Documents == nil && isArchive(ac) {
+		t.Documents = []PDF{t.PDF}
+	}
+	if t.Documents == nil && t.Copies > 1 {
+		return nil, errors.New("Copies requires a list of documents or an archive Accept header")
+	}
+	docs := t.Documents
+	if docs == nil {
+		docs = []PDF{t.PDF}
+	}
+	if err := p.limits.check(docs); err != nil {
+		return nil, err
+	}
+	if err := t.Options.check(); err != nil {
+		return nil, err
+	}
+	if t.Manifest && !isArchive(ac) {
+		return nil, errors.New("Manifest requires an archive Accept header, e.g. application/zip")
+	}
+	if err := checkDocuments(docs); err != nil {
+		return nil, err
+	}
+	if err := checkOutputNames(docs); err != nil {
+		return nil, err
+	}
+	if err := p.templates.checkURLs(docs); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
 
-	switch string(ch) {
-	case "{":
-		var x PDF
-		err := dec.Decode(&x)
+// render renders t to w.
+func (p PDFHandler) render(ctx context.Context, t *task, w io.Writer) error {
+	if t.Documents != nil {
+		return p.multi(ctx, t.accept, t.Documents, t.Options, w)
+	}
+	if err := p.admit(ctx, t.Options); err != nil {
+		return err
+	}
+	defer p.pool.release()
+	err := withTimeout(ctx, p.renderTimeout, "Rendering "+t.FileName, func(ctx context.Context) error {
+		pdf, err := p.templates.resolve(ctx, t.PDF)
 		if err != nil {
-			Error(w, err.Error(), http.StatusBadRequest)
-			return
+			return err
 		}
-		out, err := x.render(p.filePath)
+		steps, err := pdf.steps(p.renderer, p.filePath)
 		if err != nil {
-			Error(w, err.Error(), http.StatusInternalServerError)
+			return err
+		}
+		steps = append(steps, t.Options.steps(p.renderer)...)
+		return pipe(ctx, w, steps...)
+	})
+	if err == nil {
+		t.rendered()
+	}
+	if _, ok := err.(pageRangeError); ok {
+		err = documentError{0, t.FileName, err}
+	}
+	return err
+}
+
+// admit takes the first render slot of a request. Jobs wait for it as long
+// as it takes, other requests no longer than the queue timeout.
+func (p PDFHandler) admit(ctx context.Context, opts Options) error {
+	if opts.async {
+		return p.pool.acquire(ctx)
+	}
+	return p.pool.admit(ctx)
+}
+
+func (p PDFHandler) post(w http.ResponseWriter, req *http.Request) {
+	t, err := p.decodePost(req, path.Base(req.URL.Path) == "burst")
+	if err != nil {
+		badRequest(w, err)
+		return
+	}
+	if t.CallbackURL != "" {
+		Error(w, "callback_url requires a job, POST to jobs instead", http.StatusBadRequest)
+		return
+	}
+	t.setHeaders(w.Header())
+	sw := &streamWriter{ResponseWriter: w}
+
+	err = withTimeout(req.Context(), p.requestTimeout, "Request", func(ctx context.Context) error {
+		return p.render(ctx, t, sw)
+	})
+	if err != nil {
+		if req.Context().Err() != nil {
+			logger.Errorf("client went away: %q", err.Error())
 			return
 		}
-		w.Write(out)
-		break
+		p.fail(sw, err)
+	}
+}
+
+// decodeRequest decodes a json POST body, either a request object or a
+// list of documents.
+func decodeRequest(body io.Reader) (request, error) {
+	r := bufio.NewReader(body)
+	dec := json.NewDecoder(r)
+	ch, _ := r.Peek(1)
+
+	var x request
+	switch string(ch) {
+	case "{":
+		err := dec.Decode(&x)
+		return x, err
 	case "[":
-		var pdfs []PDF
-		err := dec.Decode(&pdfs)
-		if err != nil {
-			Error(w, err.Error(), http.StatusBadRequest)
-			return
+		err := dec.Decode(&x.Documents)
+		if x.Documents == nil {
+			x.Documents = []PDF{}
 		}
-		err = p.multi(ac, pdfs, w)
-		if err != nil {
-			Error(w, err.Error(), http.StatusInternalServerError)
-			return
+		return x, err
+	}
+	return x, errors.New("Invalid input")
+}
+
+// badRequest reports a request that could not be decoded or exceeds a
+// limit.
+func badRequest(w http.ResponseWriter, err error) {
+	if le, ok := err.(limitError); ok {
+		Error(w, le.Error(), le.status)
+		return
+	}
+	Error(w, err.Error(), http.StatusBadRequest)
+}
+
+// fail reports an error from rendering to the client, with a status that
+// tells timeouts and a busy handler apart from other failures.
+func (p PDFHandler) fail(w http.ResponseWriter, err error) {
+	sw, ok := w.(*streamWriter)
+	if !ok {
+		sw = &streamWriter{ResponseWriter: w}
+	}
+	cause := err
+	if de, ok := err.(documentError); ok {
+		cause = de.err
+	}
+	switch cause.(type) {
+	case pageRangeError:
+		sw.fail(err, http.StatusBadRequest)
+	case timeoutError:
+		sw.fail(err, http.StatusGatewayTimeout)
+	case saturatedError:
+		if !sw.started {
+			w.Header().Set("Retry-After", strconv.Itoa(p.pool.retryAfter()))
 		}
-		break
+		sw.fail(err, http.StatusServiceUnavailable)
 	default:
-		Error(w, "Invalid input", http.StatusBadRequest)
-		return
+		sw.fail(err, http.StatusInternalServerError)
 	}
 }
 
 func (p PDFHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if id, rest, ok := splitJobsPath(p.jobsPath, req.URL.Path); ok {
+		p.serveJobs(w, req, id, rest)
+		return
+	}
 	switch req.Method {
 	case "GET":
 		p.get(w, req)
@@ -1,18 +1,32 @@
 package pdfhandler
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"os/exec"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/StefanKjartansson/pdfhandler/internal/pdf"
 	"github.com/stretchr/testify/assert"
 )
 
-var ts *httptest.Server
+var (
+	ts         *httptest.Server
+	pdfHandler *PDFHandler
+)
+
 var (
 	single = PDF{
 		FileName: "OoPdfFormExample.pdf",
@@ -52,15 +66,125 @@ func (l *testLogger) Errorf(format string, args ...interface{}) {
 	l.t.Logf(format, args...)
 }
 
+// testRenderer runs the tests against pdftk when it is installed and the
+// native renderer otherwise, or when PDFHANDLER_NATIVE is set.
+func testRenderer() (Renderer, []Option) {
+	if _, err := exec.LookPath("pdftk"); err != nil || os.Getenv("PDFHANDLER_NATIVE") != "" {
+		return NativeRenderer{}, []Option{WithRenderer(NativeRenderer{})}
+	}
+	return PdftkRenderer{}, nil
+}
+
 func TestMain(m *testing.M) {
-	pdfHandler, _ := New("./pdf-test")
+	_, opts := testRenderer()
+	pdfHandler, _ = New("./pdf-test", opts...)
 	ts = httptest.NewServer(pdfHandler)
 	defer ts.Close()
 	os.Exit(m.Run())
 }
 
+// newTestHandler returns a handler for the test templates using the test
+// renderer, with opts applied after it.
+func newTestHandler(t *testing.T, opts ...Option) *PDFHandler {
+	_, o := testRenderer()
+	h, err := New("./pdf-test", append(o, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// atPath serves requests to h as if they were made to path, e.g. /burst.
+func atPath(path string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.URL.Path = path
+		h.ServeHTTP(w, req)
+	})
+}
+
+// withHeader serves requests to h with the request header key set to value.
+func withHeader(key, value string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req.Header.Set(key, value)
+		h.ServeHTTP(w, req)
+	})
+}
+
+// postJSON posts body encoded as json to h and returns the response along
+// with its body.
+func postJSON(t *testing.T, h http.Handler, accept string, body interface{}) (*http.Response, []byte) {
+	resp, out, err := postJSONContext(context.Background(), h, accept, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, out
+}
+
+// postJSONContext is postJSON with a request context. It returns the
+// error of a request that failed, with a nil response, or of a response
+// body that could not be read in full.
+func postJSONContext(ctx context.Context, h http.Handler, accept string, body interface{}) (*http.Response, []byte, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, nil, err
+	}
+	s := httptest.NewServer(h)
+	defer s.Close()
+	req, err := http.NewRequest("POST", s.URL, bytes.NewReader(b))
+	if err != nil {
+		return nil, nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", accept)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	out, err := ioutil.ReadAll(resp.Body)
+	return resp, out, err
+}
+
+// requireOK fails the test unless resp is 200 OK.
+func requireOK(t *testing.T, resp *http.Response, body []byte) {
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Got status %d and body %q", resp.StatusCode, body)
+	}
+}
+
+// pageContents returns the decoded content of each page of the pdf in b,
+// followed by that of the form xobjects the page draws, such as stamps.
+func pageContents(t *testing.T, b []byte) []string {
+	d, err := pdf.Open(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pages := []string{}
+	for _, r := range d.Pages() {
+		page := d.Dict(r)
+		c, err := d.Contents(page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		xobjects := d.Dict(d.Dict(d.Inherited(page, "Resources"))["XObject"])
+		for _, o := range xobjects {
+			if s, ok := d.Resolve(o).(*pdf.Stream); ok && s.Dict.Name("Subtype") == "Form" {
+				fc, err := d.Decode(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+				c = append(c, fc...)
+			}
+		}
+		pages = append(pages, string(c))
+	}
+	return pages
+}
+
 func TestPDFStruct(t *testing.T) {
-	_, err := single.render("./pdf-test")
+	r, _ := testRenderer()
+	err := single.render(context.Background(), r, "./pdf-test", ioutil.Discard)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -247,3 +371,305 @@ func TestInvalidMethod(t *testing.T) {
 	}
 	assert.Equal(t, resp.StatusCode, http.StatusMethodNotAllowed)
 }
+
+func TestPostWatermark(t *testing.T) {
+	SetLogger(&testLogger{t})
+	p := single
+	p.Watermark = &Watermark{Text: "CONFIDENTIAL - {case_no}", Opacity: 0.2, Angle: 45}
+	p.Fields = map[string]string{"Family Name Text Box": "Barsson", "case_no": "1234"}
+	p.Pages = "1,1"
+	resp, b := postJSON(t, pdfHandler, "application/pdf", p)
+	requireOK(t, resp, b)
+	pages := pageContents(t, b)
+	assert.Len(t, pages, 2)
+	for i, c := range pages {
+		assert.Contains(t, c, "(CONFIDENTIAL - 1234) Tj", "page %d", i+1)
+	}
+}
+
+// numberedPDF returns a pdf with n pages, each showing its page number in
+// words.
+func numberedPDF(t *testing.T, n int) string {
+	pages := []overlayPage{}
+	for i := 1; i <= n; i++ {
+		pages = append(pages, overlayPage{PageBox{0, 0, 200, 200}, []textMark{{Text: pageWords[i], X: 100, Y: 100, Size: 12}}})
+	}
+	b, err := overlayPDF(pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+var pageWords = []string{"zero", "one", "two", "three"}
+
+func TestPostMultiPages(t *testing.T) {
+	SetLogger(&testLogger{t})
+	pdfs := []PDF{{FileName: "numbered.pdf", Content: numberedPDF(t, 3)}, multi[1]}
+	pdfs[0].Pages = "end,1-2"
+	pdfs[1].Pages = "1"
+	resp, b := postJSON(t, pdfHandler, "application/pdf", pdfs)
+	requireOK(t, resp, b)
+	pages := pageContents(t, b)
+	if !assert.Len(t, pages, 4) {
+		return
+	}
+	for i, word := range []string{"three", "one", "two"} {
+		assert.Contains(t, pages[i], "("+word+") Tj", "page %d", i+1)
+	}
+	d, err := NativeRenderer{}.DocData(context.Background(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, PageBox{0, 0, 595, 842}, d.Media[3].Rect, "Expected the form as the last page")
+}
+
+func TestPostInvalidPages(t *testing.T) {
+	SetLogger(&testLogger{t})
+	p := single
+	p.Pages = "abc"
+	for _, body := range []interface{}{p, []PDF{single, p}} {
+		resp, b := postJSON(t, pdfHandler, "application/pdf", body)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Contains(t, string(b), `Invalid page "abc"`)
+	}
+}
+
+func TestPostPagesOutOfBounds(t *testing.T) {
+	SetLogger(&testLogger{t})
+	for _, pages := range []string{"5", "2-1"} {
+		p := single
+		p.Pages = pages
+		for _, body := range []interface{}{p, []PDF{single, p}} {
+			resp, b := postJSON(t, pdfHandler, "application/pdf", body)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+			assert.Contains(t, string(b), "(OoPdfFormExample.pdf)")
+			assert.Contains(t, string(b), "out of bounds, document has 1 pages")
+		}
+	}
+}
+
+func TestPostBookmarks(t *testing.T) {
+	SetLogger(&testLogger{t})
+	cover := single
+	cover.Title = "Cover"
+	cover.Pages = "1,1,1"
+	cover.Copies = 2
+	form := single
+	form.Title = "Form"
+	form.Pages = "1"
+	resp, b := postJSON(t, pdfHandler, "application/pdf", []PDF{cover, form})
+	requireOK(t, resp, b)
+	d, err := NativeRenderer{}.DocData(context.Background(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 7, d.NumberOfPages)
+	assert.Equal(t, []Bookmark{{"Cover", 1, 1}, {"Cover", 1, 4}, {"Form", 1, 7}}, d.Bookmarks)
+}
+
+func TestPostMetadata(t *testing.T) {
+	SetLogger(&testLogger{t})
+	resp, b := postJSON(t, pdfHandler, "application/pdf", map[string]interface{}{
+		"documents": multi,
+		"metadata":  map[string]string{"title": "Bundle", "CaseNumber": "1234", "Creator": ""},
+	})
+	requireOK(t, resp, b)
+	assert.Equal(t, resp.Header.Get("Content-Type"), "application/pdf")
+	d, err := NativeRenderer{}.DocData(context.Background(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "Bundle", d.Info["Title"])
+	assert.Equal(t, "1234", d.Info["CaseNumber"])
+	assert.NotContains(t, d.Info, "Creator")
+	assert.NotContains(t, d.Info, "title")
+}
+
+func TestPostMultiPageNumbers(t *testing.T) {
+	SetLogger(&testLogger{t})
+	resp, b := postJSON(t, pdfHandler, "application/pdf", map[string]interface{}{
+		"documents":    multi,
+		"page_numbers": PageNumbers{Format: "{page} / {pages}", Position: "bottom-right"},
+	})
+	requireOK(t, resp, b)
+	pages := pageContents(t, b)
+	assert.Len(t, pages, 2)
+	for i, c := range pages {
+		assert.Contains(t, c, fmt.Sprintf("(%d / 2) Tj", i+1), "page %d", i+1)
+	}
+}
+
+func TestPostInvalidPageNumbers(t *testing.T) {
+	SetLogger(&testLogger{t})
+	for _, pn := range []PageNumbers{{Position: "middle"}, {Format: strings.Repeat("{page}", 100)}} {
+		resp, _ := postJSON(t, pdfHandler, "application/pdf", map[string]interface{}{"documents": multi, "page_numbers": pn})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestPostBurst(t *testing.T) {
+	SetLogger(&testLogger{t})
+	resp, b := postJSON(t, atPath("/burst", pdfHandler), "application/zip", single)
+	requireOK(t, resp, b)
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 1 {
+		t.Fatalf("Expected one page, got %d", len(zr.File))
+	}
+	assert.Equal(t, zr.File[0].Name, "OoPdfFormExample-p001.pdf")
+}
+
+func TestPostBurstInvalidAccept(t *testing.T) {
+	SetLogger(&testLogger{t})
+	resp, _ := postJSON(t, atPath("/burst", pdfHandler), "application/pdf", single)
+	assert.Equal(t, resp.StatusCode, http.StatusBadRequest)
+}
+
+func TestPostMultiZipCopies(t *testing.T) {
+	SetLogger(&testLogger{t})
+	p := single
+	p.Copies = 3
+	for _, accept := range []string{"application/zip", "application/pdf"} {
+		r, _ := testRenderer()
+		c := &countingRenderer{Renderer: r}
+		h := newTestHandler(t, WithRenderer(c))
+		resp, b := postJSON(t, h, accept, []PDF{p})
+		requireOK(t, resp, b)
+		assert.Len(t, c.fills, 1, accept)
+		if accept == "application/zip" {
+			zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, len(zr.File), 3)
+		} else {
+			assert.Len(t, pageContents(t, b), 3)
+		}
+	}
+}
+
+func TestPostEmpty(t *testing.T) {
+	SetLogger(&testLogger{t})
+	for _, accept := range []string{"application/pdf", "application/zip"} {
+		for _, body := range []interface{}{[]PDF{}, map[string]interface{}{"documents": []PDF{}}} {
+			resp, b := postJSON(t, pdfHandler, accept, body)
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, accept)
+			assert.Contains(t, string(b), "Request has no documents")
+		}
+	}
+}
+
+func TestPostSingleCopies(t *testing.T) {
+	SetLogger(&testLogger{t})
+	p := single
+	p.Copies = 3
+	resp, b := postJSON(t, pdfHandler, "application/pdf", p)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, string(b), "Copies requires a list of documents")
+}
+
+func TestPostInvalidCopies(t *testing.T) {
+	SetLogger(&testLogger{t})
+	for _, copies := range []int{-1, maxCopies + 1} {
+		p := single
+		p.Copies = copies
+		resp, b := postJSON(t, pdfHandler, "application/zip", []PDF{p})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Contains(t, string(b), "Copies must be between 0 and 1000")
+	}
+}
+
+func TestOrdered(t *testing.T) {
+	ch := make(chan rendered, 4)
+	ch <- rendered{2, []job{{File: "2"}}}
+	ch <- rendered{0, []job{{File: "0a"}, {File: "0b"}}}
+	ch <- rendered{3, []job{{File: "3"}}}
+	ch <- rendered{1, nil}
+	close(ch)
+	files := []string{}
+	err := ordered(ch, func(j job) error {
+		files = append(files, j.File)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0a", "0b", "2", "3"}, files)
+}
+
+// orderRenderer fills a document with the value of its "n" field, later
+// documents of a batch finishing first, and concatenates by joining.
+type orderRenderer struct {
+	Renderer
+	n int
+}
+
+func (o orderRenderer) Fill(ctx context.Context, w io.Writer, path string, fields map[string]string, flatten bool) error {
+	n, _ := strconv.Atoi(fields["n"])
+	time.Sleep(time.Duration(o.n-n) * time.Millisecond)
+	_, err := io.WriteString(w, fields["n"])
+	return err
+}
+
+func (o orderRenderer) DocData(ctx context.Context, b []byte) (*DocData, error) {
+	return &DocData{NumberOfPages: 1}, nil
+}
+
+func (o orderRenderer) Concat(ctx context.Context, w io.Writer, files []string, d *DocData) error {
+	parts := []string{}
+	for _, fn := range files {
+		b, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, string(b))
+	}
+	_, err := io.WriteString(w, strings.Join(parts, ","))
+	return err
+}
+
+func postOrdered(t *testing.T, n int, accept string) []byte {
+	h := newTestHandler(t, WithRenderer(orderRenderer{n: n}), WithConcurrency(4))
+	pdfs := []PDF{}
+	for i := 0; i < n; i++ {
+		pdfs = append(pdfs, PDF{FileName: "OoPdfFormExample.pdf", Fields: map[string]string{"n": strconv.Itoa(i)}})
+	}
+	resp, out := postJSON(t, h, accept, pdfs)
+	requireOK(t, resp, out)
+	return out
+}
+
+func TestPostMultiOrder(t *testing.T) {
+	SetLogger(&testLogger{t})
+	expected := []string{}
+	for i := 0; i < 25; i++ {
+		expected = append(expected, strconv.Itoa(i))
+	}
+	out := postOrdered(t, 25, "application/pdf")
+	assert.Equal(t, strings.Join(expected, ","), string(out))
+}
+
+func TestPostMultiZipOrder(t *testing.T) {
+	SetLogger(&testLogger{t})
+	out := postOrdered(t, 25, "application/zip")
+	zr, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, zr.File, 25) {
+		return
+	}
+	for i, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, strconv.Itoa(i), string(b))
+	}
+}
@@ -0,0 +1,242 @@
+// Package pdfhandlertest provides a fake renderer and test server for
+// code built on pdfhandler, so that it can be tested without pdftk or
+// real templates.
+package pdfhandlertest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/StefanKjartansson/pdfhandler"
+)
+
+// Fill is a call to Renderer.Fill.
+type Fill struct {
+	// Template is the file name of the template, relative to the pdf path.
+	Template string
+	Fields   map[string]string
+	Flatten  bool
+}
+
+// Renderer is a pdfhandler.Renderer that records fills and returns a one
+// page pdf listing the filled fields instead of filling the template. The
+// rest of the pdf operations work on those pdfs in memory.
+type Renderer struct {
+	// Templates maps template file names to the names of their fields,
+	// as returned by DumpFields.
+	Templates map[string][]string
+
+	pdfhandler.NativeRenderer
+	mu    sync.Mutex
+	fills []Fill
+}
+
+// Fill records the call and writes a pdf listing the fields in order.
+func (r *Renderer) Fill(ctx context.Context, w io.Writer, path string, fields map[string]string, flatten bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	name := filepath.Base(path)
+	copied := make(map[string]string, len(fields))
+	for k, v := range fields {
+		copied[k] = v
+	}
+	r.mu.Lock()
+	r.fills = append(r.fills, Fill{name, copied, flatten})
+	r.mu.Unlock()
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	lines := []string{name}
+	for _, k := range keys {
+		lines = append(lines, k+": "+fields[k])
+	}
+	_, err := w.Write(Page(lines...))
+	return err
+}
+
+// DumpFields returns the fields listed for the template in Templates.
+func (r *Renderer) DumpFields(ctx context.Context, path string) ([]string, error) {
+	fields, ok := r.Templates[filepath.Base(path)]
+	if !ok {
+		return nil, fmt.Errorf("pdfhandlertest: unknown template %s", filepath.Base(path))
+	}
+	return fields, nil
+}
+
+// Fills returns the recorded fills in the order they were made. Documents
+// of a batch are filled concurrently, so their order is not defined.
+func (r *Renderer) Fills() []Fill {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Fill(nil), r.fills...)
+}
+
+// Reset forgets the recorded fills.
+func (r *Renderer) Reset() {
+	r.mu.Lock()
+	r.fills = nil
+	r.mu.Unlock()
+}
+
+// AssertFilled reports an error unless template was filled with fields.
+// Only the fields given are compared.
+func (r *Renderer) AssertFilled(t testing.TB, template string, fields map[string]string) bool {
+	t.Helper()
+	fills := r.Fills()
+	for _, f := range fills {
+		if f.Template != template {
+			continue
+		}
+		ok := true
+		for k, v := range fields {
+			if got, found := f.Fields[k]; !found || got != v {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	t.Errorf("pdfhandlertest: %s was not filled with %v, fills: %v", template, fields, fills)
+	return false
+}
+
+// AssertFills reports an error unless the fills, ignoring their order,
+// are exactly fills.
+func (r *Renderer) AssertFills(t testing.TB, fills ...Fill) bool {
+	t.Helper()
+	got := sortFills(r.Fills())
+	want := sortFills(fills)
+	if len(got) == 0 && len(want) == 0 || reflect.DeepEqual(got, want) {
+		return true
+	}
+	t.Errorf("pdfhandlertest: expected fills %v, got %v", want, got)
+	return false
+}
+
+// AssertNotFilled reports an error if template was filled.
+func (r *Renderer) AssertNotFilled(t testing.TB, template string) bool {
+	t.Helper()
+	for _, f := range r.Fills() {
+		if f.Template == template {
+			t.Errorf("pdfhandlertest: %s was filled with %v", template, f.Fields)
+			return false
+		}
+	}
+	return true
+}
+
+func sortFills(fills []Fill) []Fill {
+	fills = append([]Fill(nil), fills...)
+	sort.SliceStable(fills, func(i, j int) bool {
+		return fmt.Sprint(fills[i]) < fmt.Sprint(fills[j])
+	})
+	return fills
+}
+
+// Server is an httptest.Server around a pdfhandler.PDFHandler that uses
+// a fake Renderer.
+type Server struct {
+	*httptest.Server
+	Renderer *Renderer
+	dir      string
+}
+
+// NewServer starts a Server. The handler's pdf path is a temporary
+// directory holding an empty file for every template in r.Templates.
+func NewServer(r *Renderer, opts ...pdfhandler.Option) (*Server, error) {
+	dir, err := ioutil.TempDir("", "pdfhandlertest")
+	if err != nil {
+		return nil, err
+	}
+	for name := range r.Templates {
+		if strings.ContainsAny(name, `/\`) {
+			os.RemoveAll(dir)
+			return nil, errors.New("pdfhandlertest: template names must not contain a path")
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+	h, err := pdfhandler.New(dir, append([]pdfhandler.Option{pdfhandler.WithRenderer(r)}, opts...)...)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return &Server{httptest.NewServer(h), r, dir}, nil
+}
+
+// Close shuts the server down and removes its pdf path.
+func (s *Server) Close() {
+	s.Server.Close()
+	os.RemoveAll(s.dir)
+}
+
+// Page returns a minimal single page pdf showing lines of text. The same
+// lines always give the same bytes.
+func Page(lines ...string) []byte {
+	var content bytes.Buffer
+	content.WriteString("BT /F1 10 Tf 12 TL 36 806 Td\n")
+	for _, l := range lines {
+		fmt.Fprintf(&content, "(%s) '\n", escape(l))
+	}
+	content.WriteString("ET\n")
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+	}
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, o := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+// escape makes s safe for a pdf literal string, replacing characters
+// outside printable ASCII.
+func escape(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(c)
+		case c < 32 || c > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,143 @@
+package pdfhandlertest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/StefanKjartansson/pdfhandler"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T) *Server {
+	s, err := NewServer(&Renderer{Templates: map[string][]string{
+		"invoice.pdf": {"invoice_no", "customer"},
+		"letter.pdf":  {"greeting"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func post(t *testing.T, s *Server, accept string, body interface{}) *http.Response {
+	b, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", s.URL, bytes.NewBuffer(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", accept)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestPostSingle(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	resp := post(t, s, "application/pdf", pdfhandler.PDF{
+		FileName: "invoice.pdf",
+		Fields:   map[string]string{"invoice_no": "1234", "customer": "Jane"},
+	})
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	b, _ := ioutil.ReadAll(resp.Body)
+	assert.True(t, bytes.HasPrefix(b, []byte("%PDF-")))
+
+	s.Renderer.AssertFilled(t, "invoice.pdf", map[string]string{"invoice_no": "1234"})
+	s.Renderer.AssertNotFilled(t, "letter.pdf")
+}
+
+func TestPostMulti(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	resp := post(t, s, "application/pdf", map[string]interface{}{
+		"documents": []pdfhandler.PDF{
+			{FileName: "invoice.pdf", Fields: map[string]string{"invoice_no": "1"}, Pages: "1,1"},
+			{FileName: "letter.pdf", Fields: map[string]string{"greeting": "Hi"}, Flatten: true},
+		},
+		"metadata":     map[string]string{"Title": "Bundle"},
+		"page_numbers": map[string]interface{}{},
+	})
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	b, _ := ioutil.ReadAll(resp.Body)
+	d, err := s.Renderer.DocData(context.Background(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, d.NumberOfPages)
+	assert.Equal(t, "Bundle", d.Info["Title"])
+
+	s.Renderer.AssertFills(t,
+		Fill{"invoice.pdf", map[string]string{"invoice_no": "1"}, false},
+		Fill{"letter.pdf", map[string]string{"greeting": "Hi"}, true},
+	)
+}
+
+func TestGet(t *testing.T) {
+	s := newTestServer(t)
+	defer s.Close()
+
+	resp, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var pdfs []pdfhandler.PDF
+	if err := json.NewDecoder(resp.Body).Decode(&pdfs); err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, pdfs, 2)
+	for _, p := range pdfs {
+		if p.FileName == "invoice.pdf" {
+			assert.Equal(t, map[string]string{"invoice_no": "", "customer": ""}, p.Fields)
+		}
+	}
+}
+
+// recorder counts the errors reported through it instead of failing.
+type recorder struct {
+	testing.TB
+	errors int
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) { r.errors++ }
+
+func TestAssertions(t *testing.T) {
+	r := &Renderer{}
+	r.Fill(context.Background(), ioutil.Discard, "/tmp/invoice.pdf", map[string]string{"invoice_no": "1"}, false)
+
+	m := &recorder{TB: t}
+	assert.False(t, r.AssertFilled(m, "invoice.pdf", map[string]string{"invoice_no": "2"}))
+	assert.False(t, r.AssertNotFilled(m, "invoice.pdf"))
+	assert.False(t, r.AssertFills(m))
+	assert.Equal(t, 3, m.errors)
+	assert.True(t, r.AssertFilled(t, "invoice.pdf", nil))
+
+	r.Reset()
+	assert.True(t, r.AssertFills(t))
+}
+
+func TestPage(t *testing.T) {
+	assert.Equal(t, Page("a", "(b)"), Page("a", "(b)"))
+	d, err := (&Renderer{}).DocData(context.Background(), Page("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, d.NumberOfPages)
+}
@@ -0,0 +1,173 @@
+package pdfhandler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PdftkRenderer implements Renderer by running pdftk.
+type PdftkRenderer struct{}
+
+func (PdftkRenderer) Fill(ctx context.Context, w io.Writer, path string, fields map[string]string, flatten bool) error {
+	fn, err := writeTempFile(mapToXFDF(fields))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fn)
+	args := []string{path, "fill_form", fn, "output", "-"}
+	if flatten {
+		args = append(args, "flatten")
+	}
+	return runPdftk(ctx, w, nil, args...)
+}
+
+func (PdftkRenderer) DumpFields(ctx context.Context, path string) ([]string, error) {
+	var out bytes.Buffer
+	if err := runPdftk(ctx, &out, nil, path, "dump_data_fields_utf8"); err != nil {
+		return nil, err
+	}
+	p := scanFields("", &out)
+	names := make([]string, 0, len(p.Fields))
+	for k := range p.Fields {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (p PdftkRenderer) SelectPages(ctx context.Context, w io.Writer, b []byte, ranges []PageRange) error {
+	d, err := p.DocData(ctx, b)
+	if err != nil {
+		return err
+	}
+	if err := checkPageRanges(ranges, d.NumberOfPages); err != nil {
+		return err
+	}
+	args := []string{"-", "cat"}
+	for _, r := range ranges {
+		args = append(args, r.String())
+	}
+	args = append(args, "output", "-")
+	return runPdftk(ctx, w, b, args...)
+}
+
+func (PdftkRenderer) Concat(ctx context.Context, w io.Writer, files []string, d *DocData) error {
+	args := append(append([]string{}, files...), "cat", "output", "-")
+	if d == nil {
+		return runPdftk(ctx, w, nil, args...)
+	}
+	// pdftk does one operation per run, so the joined pdf goes through a
+	// temporary file rather than memory on its way to update_info.
+	f, err := ioutil.TempFile("", "pdfhandler")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	err = runPdftk(ctx, f, nil, args...)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	fn, err := writeTempFile([]byte(d.String()))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fn)
+	return runPdftk(ctx, w, nil, f.Name(), "update_info_utf8", fn, "output", "-")
+}
+
+func (PdftkRenderer) DocData(ctx context.Context, b []byte) (*DocData, error) {
+	var out bytes.Buffer
+	if err := runPdftk(ctx, &out, b, "-", "dump_data_utf8"); err != nil {
+		return nil, err
+	}
+	return scanDocData(&out), nil
+}
+
+func (PdftkRenderer) UpdateInfo(ctx context.Context, w io.Writer, b []byte, d *DocData) error {
+	fn, err := writeTempFile([]byte(d.String()))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fn)
+	return runPdftk(ctx, w, b, "-", "update_info_utf8", fn, "output", "-")
+}
+
+func (PdftkRenderer) Stamp(ctx context.Context, w io.Writer, b, overlay []byte) error {
+	fn, err := writeTempFile(overlay)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fn)
+	return runPdftk(ctx, w, b, "-", "multistamp", fn, "output", "-")
+}
+
+func (PdftkRenderer) Burst(ctx context.Context, b []byte, dir string) ([]string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	// pdftk writes a doc_data.txt report to its working directory.
+	err := runPdftkIn(ctx, dir, nil, b, "-", "burst", "output", filepath.Join(dir, "p%06d.pdf"))
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "p*.pdf"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// runPdftk executes pdftk with args, feeding stdin to the process when
+// it is non nil, and streams what pdftk writes to stdout to w. pdftk is
+// killed if ctx is done before it exits.
+func runPdftk(ctx context.Context, w io.Writer, stdin []byte, args ...string) error {
+	return runPdftkIn(ctx, "", w, stdin, args...)
+}
+
+// runPdftkIn is runPdftk with dir as the working directory of pdftk.
+func runPdftkIn(ctx context.Context, dir string, w io.Writer, stdin []byte, args ...string) error {
+	cmd := exec.CommandContext(ctx, "pdftk", args...)
+	cmd.Dir = dir
+	logger.Debugf("Executing pdftk %q", strings.Join(cmd.Args, " "))
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	cmd.Stdout = w
+	var t bytes.Buffer
+	cmd.Stderr = &t
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil && t.Len() > 0 {
+		return errors.New(t.String())
+	}
+	return err
+}
+
+// writeTempFile writes b to a new temporary file and returns its name.
+// The caller is responsible for removing it.
+func writeTempFile(b []byte) (string, error) {
+	f, err := ioutil.TempFile("", "pdfhandler")
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
@@ -0,0 +1,57 @@
+//go:build !windows
+// +build !windows
+
+package pdfhandler
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// TestRunPdftkKilled runs a fake pdftk that hangs and checks that it is
+// killed once the context is done.
+func TestRunPdftkKilled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fakepdftk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pidfile := filepath.Join(dir, "pid")
+	script := "#!/bin/sh\necho $$ > " + pidfile + "\nexec sleep 30\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "pdftk"), []byte(script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+path)
+	defer os.Setenv("PATH", path)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = runPdftk(ctx, ioutil.Discard, nil, "dump_data")
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("pdftk ran for %s", d)
+	}
+
+	b, err := ioutil.ReadFile(pidfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(pid, 0); err != syscall.ESRCH {
+		t.Fatalf("Expected pdftk (pid %d) to be gone, got %v", pid, err)
+	}
+}
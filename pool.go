@@ -0,0 +1,76 @@
+package pdfhandler
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// saturatedError reports that no render slot became free in time.
+type saturatedError struct {
+	wait time.Duration
+}
+
+func (e saturatedError) Error() string {
+	return fmt.Sprintf("Too many renders in progress, none could start within %s", e.wait)
+}
+
+// pool limits the number of renders running at once across all requests
+// of a handler. Every fill, concatenation or field listing takes a slot.
+type pool struct {
+	slots chan struct{}
+	// wait is how long a request waits for its first slot.
+	wait time.Duration
+}
+
+func newPool(size int, wait time.Duration) *pool {
+	if size < 1 {
+		size = 1
+	}
+	return &pool{slots: make(chan struct{}, size), wait: wait}
+}
+
+// admit takes the first slot of a request, failing with a saturatedError
+// if none is free within the queue timeout.
+func (p *pool) admit(ctx context.Context) error {
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	default:
+	}
+	timer := time.NewTimer(p.wait)
+	defer timer.Stop()
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return saturatedError{p.wait}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// acquire takes another slot for an admitted request, waiting as long as
+// ctx allows.
+func (p *pool) acquire(ctx context.Context) error {
+	select {
+	case p.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *pool) release() {
+	<-p.slots
+}
+
+// retryAfter is the number of seconds a client turned away should wait
+// before trying again.
+func (p *pool) retryAfter() int {
+	s := int((p.wait + time.Second - 1) / time.Second)
+	if s < 1 {
+		s = 1
+	}
+	return s
+}
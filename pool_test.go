@@ -0,0 +1,78 @@
+package pdfhandler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	p := newPool(2, 20*time.Millisecond)
+	ctx := context.Background()
+	assert.NoError(t, p.admit(ctx))
+	assert.NoError(t, p.acquire(ctx))
+	_, ok := p.admit(ctx).(saturatedError)
+	assert.True(t, ok)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(t, context.Canceled, p.acquire(cctx))
+
+	p.release()
+	assert.NoError(t, p.admit(ctx))
+	assert.Equal(t, 1, p.retryAfter())
+	assert.Equal(t, 3, newPool(1, 2500*time.Millisecond).retryAfter())
+}
+
+func TestPostSaturated(t *testing.T) {
+	SetLogger(&testLogger{t})
+	r, _ := testRenderer()
+	cancelled := make(chan error, 10)
+	h := newTestHandler(t,
+		WithRenderer(blockingRenderer{r, cancelled}),
+		WithConcurrency(1),
+		WithQueueTimeout(50*time.Millisecond))
+
+	// Occupy the only slot until busy is cancelled.
+	busy, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		postJSONContext(busy, h, "application/zip", single)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	for _, body := range []interface{}{single, multi} {
+		resp, b := postJSON(t, h, "application/zip", body)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+		assert.Contains(t, string(b), "Too many renders in progress")
+	}
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-cancelled)
+	// The busy handler logs after its client went away, wait for it.
+	<-done
+
+	// The slot is free again.
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestPostMultiConcurrency(t *testing.T) {
+	SetLogger(&testLogger{t})
+	h := newTestHandler(t, WithConcurrency(1))
+	docs := []PDF{}
+	for i := 0; i < 5; i++ {
+		docs = append(docs, single)
+	}
+	resp, _ := postJSON(t, h, "application/pdf", docs)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Eventually(t, func() bool { return len(h.pool.slots) == 0 }, time.Second, 10*time.Millisecond)
+}
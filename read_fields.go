@@ -2,10 +2,8 @@ package pdfhandler
 
 import (
 	"bufio"
-	"bytes"
-	"errors"
+	"context"
 	"io"
-	"os/exec"
 	"path/filepath"
 	"strings"
 )
@@ -25,17 +23,17 @@ func scanFields(filename string, r io.Reader) *PDF {
 	return &p
 }
 
-func readFields(rootPath, fp string) (*PDF, error) {
-	path := filepath.Join(rootPath, fp)
-	cmd := exec.Command("pdftk", path, "dump_data_fields_utf8")
-	logger.Debugf("Executing pdftk %q", strings.Join(cmd.Args, " "))
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	var t bytes.Buffer
-	cmd.Stderr = &t
-	err := cmd.Run()
+func readFields(ctx context.Context, r Renderer, rootPath, fp string) (*PDF, error) {
+	names, err := r.DumpFields(ctx, filepath.Join(rootPath, fp))
 	if err != nil {
-		return nil, errors.New(t.String())
+		return nil, err
 	}
-	return scanFields(fp, &out), nil
+	p := PDF{
+		FileName: fp,
+		Fields:   make(map[string]string, len(names)),
+	}
+	for _, n := range names {
+		p.Fields[n] = ""
+	}
+	return &p, nil
 }
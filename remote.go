@@ -0,0 +1,205 @@
+package pdfhandler
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTemplateTimeout    = 30 * time.Second
+	defaultMaxTemplateBytes   = 10 << 20
+	defaultTemplateCacheBytes = 64 << 20
+)
+
+// remoteTemplates downloads templates given by url from allowlisted hosts
+// and caches them by their ETag or Last-Modified header.
+type remoteTemplates struct {
+	hosts    map[string]bool
+	timeout  time.Duration
+	maxBytes int64
+	client   *http.Client
+	cache    *templateCache
+}
+
+// cachedTemplate is a downloaded template with the validators it was
+// served with.
+type cachedTemplate struct {
+	url          string
+	etag         string
+	lastModified string
+	body         []byte
+}
+
+// templateCache holds the most recently used templates, evicting the least
+// recently used ones once their bodies exceed maxBytes in total.
+type templateCache struct {
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+func newTemplateCache(maxBytes int64) *templateCache {
+	return &templateCache{maxBytes: maxBytes, lru: list.New(), entries: map[string]*list.Element{}}
+}
+
+// get returns the cached template for u, marking it recently used.
+func (c *templateCache) get(u string) (cachedTemplate, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[u]
+	if !ok {
+		return cachedTemplate{}, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(cachedTemplate), true
+}
+
+// put caches t, unless it alone exceeds the size of the cache.
+func (c *templateCache) put(t cachedTemplate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(t.url)
+	if int64(len(t.body)) > c.maxBytes {
+		return
+	}
+	c.entries[t.url] = c.lru.PushFront(t)
+	c.size += int64(len(t.body))
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back().Value.(cachedTemplate).url)
+	}
+}
+
+// delete removes the cached template for u.
+func (c *templateCache) delete(u string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(u)
+}
+
+func (c *templateCache) remove(u string) {
+	if e, ok := c.entries[u]; ok {
+		c.lru.Remove(e)
+		delete(c.entries, u)
+		c.size -= int64(len(e.Value.(cachedTemplate).body))
+	}
+}
+
+func newRemoteTemplates(hosts []string, timeout time.Duration, maxBytes, cacheBytes int64) *remoteTemplates {
+	rt := &remoteTemplates{
+		hosts:    map[string]bool{},
+		timeout:  timeout,
+		maxBytes: maxBytes,
+		cache:    newTemplateCache(cacheBytes),
+	}
+	for _, h := range hosts {
+		rt.hosts[strings.ToLower(h)] = true
+	}
+	rt.client = &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("Too many redirects")
+			}
+			return rt.check(req.URL)
+		},
+	}
+	return rt
+}
+
+// check validates that templates may be downloaded from u.
+func (rt *remoteTemplates) check(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("Invalid template url %q, expected http or https", u.String())
+	}
+	if !rt.hosts[strings.ToLower(u.Host)] && !rt.hosts[strings.ToLower(u.Hostname())] {
+		return fmt.Errorf("Templates can not be downloaded from %s", u.Host)
+	}
+	return nil
+}
+
+// checkURLs validates the template urls of pdfs.
+func (rt *remoteTemplates) checkURLs(pdfs []PDF) error {
+	for _, p := range pdfs {
+		if p.URL == "" {
+			continue
+		}
+		u, err := url.Parse(p.URL)
+		if err != nil {
+			return fmt.Errorf("Invalid template url %q", p.URL)
+		}
+		if err := rt.check(u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve downloads the template of p if it has a url, returning p with
+// the template as its content.
+func (rt *remoteTemplates) resolve(ctx context.Context, p PDF) (PDF, error) {
+	if p.URL == "" {
+		return p, nil
+	}
+	err := withTimeout(ctx, rt.timeout, "Downloading "+p.URL, func(ctx context.Context) error {
+		var err error
+		p.content, err = rt.fetch(ctx, p.URL)
+		return err
+	})
+	return p, err
+}
+
+func (rt *remoteTemplates) fetch(ctx context.Context, u string) ([]byte, error) {
+	cached, ok := rt.cache.get(u)
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if ok {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+	resp, err := rt.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && ok:
+		logger.Debugf("Template %s not modified", u)
+		return cached.body, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("Downloading %s failed: %s", u, resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, rt.maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > rt.maxBytes {
+		return nil, fmt.Errorf("Template %s exceeds the limit of %d bytes", u, rt.maxBytes)
+	}
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag != "" || lastModified != "" {
+		rt.cache.put(cachedTemplate{u, etag, lastModified, body})
+	} else {
+		rt.cache.delete(u)
+	}
+	return body, nil
+}
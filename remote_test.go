@@ -0,0 +1,166 @@
+package pdfhandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// templateServer serves the test template with an ETag and counts full
+// and not modified responses.
+type templateServer struct {
+	*httptest.Server
+	mu          sync.Mutex
+	full        int
+	notModified int
+}
+
+func newTemplateServer(t *testing.T) *templateServer {
+	b, err := ioutil.ReadFile(testTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := &templateServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/forms/form.pdf", func(w http.ResponseWriter, r *http.Request) {
+		ts.mu.Lock()
+		defer ts.mu.Unlock()
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			ts.notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		ts.full++
+		w.Header().Set("ETag", `"v1"`)
+		w.Write(b)
+	})
+	mux.HandleFunc("/slow.pdf", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	mux.HandleFunc("/redirect.pdf", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://example.com/form.pdf", http.StatusFound)
+	})
+	ts.Server = httptest.NewServer(mux)
+	return ts
+}
+
+func remoteHandler(t *testing.T, ts *templateServer, opts ...Option) http.Handler {
+	u, _ := url.Parse(ts.URL)
+	return newTestHandler(t, append([]Option{WithTemplateHosts(u.Host)}, opts...)...)
+}
+
+func TestRemoteTemplate(t *testing.T) {
+	SetLogger(&testLogger{t})
+	ts := newTemplateServer(t)
+	defer ts.Close()
+	h := remoteHandler(t, ts)
+
+	p := PDF{URL: ts.URL + "/forms/form.pdf", Fields: map[string]string{"Family Name Text Box": "Barsson"}}
+	for i := 0; i < 2; i++ {
+		resp, body := postJSON(t, h, "application/pdf", p)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+		assert.True(t, bytes.HasPrefix(body, []byte("%PDF")))
+	}
+	assert.Equal(t, 1, ts.full)
+	assert.Equal(t, 1, ts.notModified)
+}
+
+func TestTemplateCache(t *testing.T) {
+	c := newTemplateCache(6)
+	put := func(u string, n int) {
+		c.put(cachedTemplate{url: u, etag: `"v1"`, body: make([]byte, n)})
+	}
+	put("a", 3)
+	put("b", 3)
+	_, ok := c.get("a")
+	assert.True(t, ok)
+	put("c", 3)
+	_, ok = c.get("b")
+	assert.False(t, ok, "Expected the least recently used template to be evicted")
+	_, ok = c.get("a")
+	assert.True(t, ok)
+	put("a", 7)
+	_, ok = c.get("a")
+	assert.False(t, ok, "Expected a template larger than the cache to be dropped")
+	assert.Equal(t, int64(3), c.size)
+}
+
+func TestRemoteTemplateNoCache(t *testing.T) {
+	SetLogger(&testLogger{t})
+	ts := newTemplateServer(t)
+	defer ts.Close()
+	h := remoteHandler(t, ts, WithTemplateCacheBytes(0))
+
+	for i := 0; i < 2; i++ {
+		resp, body := postJSON(t, h, "application/pdf", PDF{URL: ts.URL + "/forms/form.pdf"})
+		assert.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	}
+	assert.Equal(t, 2, ts.full)
+	assert.Equal(t, 0, ts.notModified)
+}
+
+func TestRemoteTemplateManifest(t *testing.T) {
+	SetLogger(&testLogger{t})
+	ts := newTemplateServer(t)
+	defer ts.Close()
+
+	u := ts.URL + "/forms/form.pdf"
+	resp, b := postJSON(t, remoteHandler(t, ts), "application/x-tar", map[string]interface{}{
+		"documents": []PDF{{URL: u}, single},
+		"manifest":  true,
+	})
+	requireOK(t, resp, b)
+	files, _ := readTar(t, "application/x-tar", b)
+	var m manifest
+	if err := json.Unmarshal(files["manifest.json"], &m); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, m.Documents, 2) {
+		assert.Equal(t, u, m.Documents[0].Template)
+		assert.Equal(t, "OoPdfFormExample.pdf", m.Documents[1].Template)
+	}
+}
+
+func TestRemoteTemplateHostNotAllowed(t *testing.T) {
+	SetLogger(&testLogger{t})
+	ts := newTemplateServer(t)
+	defer ts.Close()
+	h := newTestHandler(t, WithTemplateHosts("forms.example.com"))
+	for _, u := range []string{ts.URL + "/forms/form.pdf", "file:///etc/passwd"} {
+		resp, body := postJSON(t, h, "application/pdf", PDF{URL: u})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, string(body))
+	}
+	assert.Equal(t, 0, ts.full)
+}
+
+func TestRemoteTemplateLimits(t *testing.T) {
+	SetLogger(&testLogger{t})
+	ts := newTemplateServer(t)
+	defer ts.Close()
+
+	resp, body := postJSON(t, remoteHandler(t, ts, WithMaxTemplateBytes(100)), "application/pdf", PDF{URL: ts.URL + "/forms/form.pdf"})
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Contains(t, string(body), "exceeds the limit of 100 bytes")
+
+	resp, body = postJSON(t, remoteHandler(t, ts, WithTemplateTimeout(50*time.Millisecond)), "application/pdf", PDF{URL: ts.URL + "/slow.pdf"})
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	assert.Contains(t, string(body), "timed out after 50ms")
+
+	resp, body = postJSON(t, remoteHandler(t, ts), "application/pdf", PDF{URL: ts.URL + "/redirect.pdf"})
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Contains(t, string(body), "can not be downloaded from example.com")
+}
+
+func TestRemoteTemplateOutputName(t *testing.T) {
+	name, err := PDF{URL: "https://forms.example.com/tax/form.pdf?v=2"}.outputName()
+	assert.NoError(t, err)
+	assert.Equal(t, "form.pdf", name)
+}
@@ -0,0 +1,36 @@
+package pdfhandler
+
+import (
+	"context"
+	"io"
+)
+
+// Renderer performs the pdf operations the handler is built on. The
+// handler uses PdftkRenderer unless another one is given to New with
+// WithRenderer, which allows the backend to be wrapped, instrumented or
+// replaced.
+//
+// Operations that produce a pdf write it to w as it is generated, so
+// that the last one of a request streams straight to the client. They
+// should stop and return ctx.Err() once ctx is done, which happens when
+// the client goes away or a timeout passes.
+type Renderer interface {
+	// Fill fills the form of the template at path with fields.
+	Fill(ctx context.Context, w io.Writer, path string, fields map[string]string, flatten bool) error
+	// DumpFields lists the form fields of the template at path.
+	DumpFields(ctx context.Context, path string) ([]string, error)
+	// SelectPages picks the pages in ranges from the pdf in b.
+	SelectPages(ctx context.Context, w io.Writer, b []byte, ranges []PageRange) error
+	// Concat joins the pdf files in order, applying the info and
+	// bookmarks in d unless it is nil.
+	Concat(ctx context.Context, w io.Writer, files []string, d *DocData) error
+	// DocData reads the page count, page sizes and info of the pdf in b.
+	DocData(ctx context.Context, b []byte) (*DocData, error)
+	// UpdateInfo applies the info and bookmarks in d to the pdf in b.
+	UpdateInfo(ctx context.Context, w io.Writer, b []byte, d *DocData) error
+	// Stamp draws page i of overlay on top of page i of the pdf in b.
+	Stamp(ctx context.Context, w io.Writer, b, overlay []byte) error
+	// Burst splits the pdf in b into one file per page in dir, returning
+	// the file names in page order.
+	Burst(ctx context.Context, b []byte, dir string) ([]string, error)
+}
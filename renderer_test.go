@@ -0,0 +1,72 @@
+package pdfhandler
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingRenderer wraps a Renderer and counts the templates it fills.
+type countingRenderer struct {
+	Renderer
+	mu    sync.Mutex
+	fills []string
+}
+
+func (c *countingRenderer) Fill(ctx context.Context, w io.Writer, path string, fields map[string]string, flatten bool) error {
+	c.mu.Lock()
+	c.fills = append(c.fills, path)
+	c.mu.Unlock()
+	return c.Renderer.Fill(ctx, w, path, fields, flatten)
+}
+
+func TestWithRenderer(t *testing.T) {
+	SetLogger(&testLogger{t})
+	r, _ := testRenderer()
+	c := &countingRenderer{Renderer: r}
+	h := newTestHandler(t, WithRenderer(c))
+
+	resp, _ := postJSON(t, h, "application/pdf", multi)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []string{"pdf-test/OoPdfFormExample.pdf", "pdf-test/OoPdfFormExample.pdf"}, c.fills)
+}
+
+func TestFillContent(t *testing.T) {
+	SetLogger(&testLogger{t})
+	r, _ := testRenderer()
+	c := &countingRenderer{Renderer: r}
+	h := newTestHandler(t, WithRenderer(c))
+
+	template, err := ioutil.ReadFile(testTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := PDF{
+		FileName: "upload.pdf",
+		Content:  base64.StdEncoding.EncodeToString(template),
+		Fields:   map[string]string{"Family Name Text Box": "Barsson"},
+		Flatten:  true,
+	}
+	resp, out := postJSON(t, h, "application/pdf", p)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	if !assert.Len(t, c.fills, 1) {
+		return
+	}
+	_, err = os.Stat(c.fills[0])
+	assert.True(t, os.IsNotExist(err), "Expected the uploaded template to be removed")
+
+	fn := writeTestFile(t, out)
+	defer os.Remove(fn)
+	names, err := NativeRenderer{}.DumpFields(context.Background(), fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, names, "Expected a flattened form")
+}
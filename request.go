@@ -0,0 +1,142 @@
+package pdfhandler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// standardInfoKeys are the document information entries defined by the
+// pdf specification, matched case insensitively in Options.Metadata.
+var standardInfoKeys = []string{"Title", "Author", "Subject", "Keywords", "Creator", "Producer"}
+
+// Options are request level settings, applied to the final output of a
+// single render or of a concatenated batch.
+type Options struct {
+	// Metadata sets entries in the document information dictionary of the
+	// output. Keys other than the standard ones are added as custom keys,
+	// an empty value removes the entry.
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// PageNumbers numbers the pages of the output, counting over the
+	// whole concatenated document rather than per input.
+	PageNumbers *PageNumbers `json:"page_numbers,omitempty"`
+
+	// OnError decides what happens when a document of a batch fails to
+	// render: "strict", the default, fails the request and "lenient"
+	// leaves the document out.
+	OnError string `json:"on_error,omitempty"`
+
+	// Manifest adds a manifest.json to zip output, describing every file
+	// of the archive.
+	Manifest bool `json:"manifest,omitempty"`
+
+	// CallbackURL is posted a signed event when a job finishes. It is
+	// only accepted for jobs.
+	CallbackURL string `json:"callback_url,omitempty"`
+
+	// Burst splits every document into single page pdfs, it is set by
+	// the burst endpoint rather than the request body.
+	burst bool
+
+	// requestID identifies the request in the manifest.
+	requestID string
+
+	// boundary separates the parts of multipart output.
+	boundary string
+
+	// async is set for jobs, which wait for a render slot rather than
+	// being turned away when the handler is busy.
+	async bool
+
+	// onRendered is called as each document finishes rendering or, for
+	// lenient output, fails.
+	onRendered func()
+}
+
+// request is the object form of a POST body. A single document carries
+// its options next to its own fields, a batch lists its documents under
+// "documents".
+type request struct {
+	PDF
+	Options
+	Documents []PDF `json:"documents,omitempty"`
+}
+
+const (
+	onErrorStrict  = "strict"
+	onErrorLenient = "lenient"
+)
+
+// check validates the options.
+func (o Options) check() error {
+	if o.PageNumbers != nil {
+		if err := o.PageNumbers.check(); err != nil {
+			return err
+		}
+	}
+	switch o.OnError {
+	case "", onErrorStrict, onErrorLenient:
+		return nil
+	}
+	return fmt.Errorf("Invalid on_error %q, expected %q or %q", o.OnError, onErrorStrict, onErrorLenient)
+}
+
+func (o Options) lenient() bool {
+	return o.OnError == onErrorLenient
+}
+
+// rendered reports that a document has finished.
+func (o Options) rendered() {
+	if o.onRendered != nil {
+		o.onRendered()
+	}
+}
+
+func infoKey(k string) string {
+	for _, s := range standardInfoKeys {
+		if strings.EqualFold(k, s) {
+			return s
+		}
+	}
+	return k
+}
+
+func (o Options) info() map[string]string {
+	info := make(map[string]string, len(o.Metadata))
+	for k, v := range o.Metadata {
+		info[infoKey(k)] = v
+	}
+	return info
+}
+
+// steps are the steps that apply the options to a rendered single pdf.
+func (o Options) steps(r Renderer) []step {
+	steps := o.pageNumberSteps(r)
+	if len(o.Metadata) > 0 {
+		steps = append(steps, func(ctx context.Context, w io.Writer, b []byte) error {
+			return r.UpdateInfo(ctx, w, b, &DocData{Info: o.info()})
+		})
+	}
+	return steps
+}
+
+// concatSteps are the steps that join files into one pdf with bookmarks
+// and apply the options. The joined pdf streams straight to the output
+// unless its pages are numbered.
+func (o Options) concatSteps(r Renderer, files []string, bookmarks []Bookmark) []step {
+	concat := func(ctx context.Context, w io.Writer, _ []byte) error {
+		return r.Concat(ctx, w, files, &DocData{Info: o.info(), Bookmarks: bookmarks})
+	}
+	return append([]step{concat}, o.pageNumberSteps(r)...)
+}
+
+func (o Options) pageNumberSteps(r Renderer) []step {
+	if o.PageNumbers == nil {
+		return nil
+	}
+	return []step{func(ctx context.Context, w io.Writer, b []byte) error {
+		return o.PageNumbers.stamp(ctx, r, w, b)
+	}}
+}
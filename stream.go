@@ -0,0 +1,61 @@
+package pdfhandler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+)
+
+// step transforms the pdf in b, writing the result to w.
+type step func(ctx context.Context, w io.Writer, b []byte) error
+
+// pipe runs steps in order, each on the output of the one before, and
+// streams the output of the last one to w. Only the intermediate results
+// are buffered.
+func pipe(ctx context.Context, w io.Writer, steps ...step) error {
+	var b []byte
+	for i, s := range steps {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if i == len(steps)-1 {
+			return s(ctx, w, b)
+		}
+		var buf bytes.Buffer
+		if err := s(ctx, &buf, b); err != nil {
+			return err
+		}
+		b = buf.Bytes()
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// streamWriter is a http.ResponseWriter that remembers whether any of
+// the body has been written, after which the status can not change.
+type streamWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (s *streamWriter) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		// An empty write would still commit the status.
+		return 0, nil
+	}
+	s.started = true
+	return s.ResponseWriter.Write(b)
+}
+
+// fail reports err with code if nothing has been written yet. Otherwise
+// the response is aborted, so that the client sees the connection close
+// before the end of the body instead of a complete looking response.
+func (s *streamWriter) fail(err error, code int) {
+	if !s.started {
+		Error(s.ResponseWriter, err.Error(), code)
+		return
+	}
+	logger.Errorf("aborting response: %q", err.Error())
+	panic(http.ErrAbortHandler)
+}
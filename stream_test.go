@@ -0,0 +1,105 @@
+package pdfhandler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipe(t *testing.T) {
+	appendStep := func(s string) step {
+		return func(ctx context.Context, w io.Writer, b []byte) error {
+			_, err := w.Write(append(append([]byte{}, b...), s...))
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	if err := pipe(context.Background(), &buf, appendStep("a"), appendStep("b"), appendStep("c")); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "abc", buf.String())
+
+	fail := func(ctx context.Context, w io.Writer, b []byte) error { return errors.New("failed") }
+	buf.Reset()
+	assert.Error(t, pipe(context.Background(), &buf, fail, appendStep("b")))
+	assert.Equal(t, 0, buf.Len())
+}
+
+// failingRenderer writes n bytes of the final, bookmarked pdf and then
+// fails.
+type failingRenderer struct {
+	Renderer
+	n int
+}
+
+func (f failingRenderer) Concat(ctx context.Context, w io.Writer, files []string, d *DocData) error {
+	w.Write(bytes.Repeat([]byte{'%'}, f.n))
+	return errors.New("pdftk crashed")
+}
+
+func TestStreamFailureBeforeOutput(t *testing.T) {
+	SetLogger(&testLogger{t})
+	r, _ := testRenderer()
+	resp, _ := postJSON(t, newTestHandler(t, WithRenderer(failingRenderer{r, 0})), "application/pdf", multi)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+func TestStreamFailureMidStream(t *testing.T) {
+	SetLogger(&testLogger{t})
+	r, _ := testRenderer()
+	h := newTestHandler(t, WithRenderer(failingRenderer{r, 1 << 16}))
+	resp, _, err := postJSONContext(context.Background(), h, "application/pdf", multi)
+	if err == nil {
+		t.Fatalf("Expected a truncated response, got status %d", resp.StatusCode)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+// streamingRenderer writes the start of the concatenated pdf and waits for
+// it to reach the output before finishing.
+type streamingRenderer struct {
+	Renderer
+	received chan struct{}
+}
+
+func (s streamingRenderer) Concat(ctx context.Context, w io.Writer, files []string, d *DocData) error {
+	w.Write(bytes.Repeat([]byte{'%'}, 1<<16))
+	select {
+	case <-s.received:
+		return nil
+	case <-time.After(5 * time.Second):
+		return errors.New("Output was buffered")
+	}
+}
+
+// notifyingWriter closes received on the first write.
+type notifyingWriter struct {
+	bytes.Buffer
+	once     sync.Once
+	received chan struct{}
+}
+
+func (n *notifyingWriter) Write(b []byte) (int, error) {
+	n.once.Do(func() { close(n.received) })
+	return n.Buffer.Write(b)
+}
+
+func TestConcatStreams(t *testing.T) {
+	SetLogger(&testLogger{t})
+	r, _ := testRenderer()
+	received := make(chan struct{})
+	h := newTestHandler(t, WithRenderer(streamingRenderer{r, received}))
+	w := &notifyingWriter{received: received}
+	opts := Options{Metadata: map[string]string{"title": "Bundle"}}
+	if err := h.multi(context.Background(), "application/pdf", multi, opts, w); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1<<16, w.Len())
+}
@@ -0,0 +1,33 @@
+package pdfhandler
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// timeoutError reports that rendering took longer than allowed.
+type timeoutError struct {
+	what    string
+	timeout time.Duration
+}
+
+func (e timeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", e.what, e.timeout)
+}
+
+// withTimeout calls f with ctx limited to timeout, if it is positive. An
+// error caused by the timeout passing is replaced by a timeoutError
+// naming what timed out.
+func withTimeout(ctx context.Context, timeout time.Duration, what string, f func(context.Context) error) error {
+	if timeout <= 0 {
+		return f(ctx)
+	}
+	tctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err := f(tctx)
+	if err != nil && tctx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return timeoutError{what, timeout}
+	}
+	return err
+}
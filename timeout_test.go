@@ -0,0 +1,106 @@
+package pdfhandler
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// blockingRenderer fills nothing until its context is done, and reports
+// the context error on cancelled.
+type blockingRenderer struct {
+	Renderer
+	cancelled chan error
+}
+
+func (b blockingRenderer) Fill(ctx context.Context, w io.Writer, path string, fields map[string]string, flatten bool) error {
+	<-ctx.Done()
+	b.cancelled <- ctx.Err()
+	return ctx.Err()
+}
+
+// tempDir points the temporary directory at a new empty directory until
+// the returned function is called.
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "pdfhandler-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, ok := os.LookupEnv("TMPDIR")
+	os.Setenv("TMPDIR", dir)
+	return dir, func() {
+		if ok {
+			os.Setenv("TMPDIR", old)
+		} else {
+			os.Unsetenv("TMPDIR")
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+// blockingHandler renders with a blockingRenderer and enough concurrency
+// for multi to block on all of its documents at once.
+func blockingHandler(t *testing.T, opts ...Option) (*PDFHandler, chan error) {
+	r, _ := testRenderer()
+	cancelled := make(chan error, 10)
+	opts = append([]Option{WithRenderer(blockingRenderer{r, cancelled}), WithConcurrency(len(multi))}, opts...)
+	return newTestHandler(t, opts...), cancelled
+}
+
+func TestRenderTimeout(t *testing.T) {
+	SetLogger(&testLogger{t})
+	dir, restore := tempDir(t)
+	defer restore()
+
+	h, cancelled := blockingHandler(t, WithRenderTimeout(50*time.Millisecond))
+	resp, b := postJSON(t, h, "application/pdf", single)
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	assert.Contains(t, string(b), "Rendering OoPdfFormExample.pdf timed out after 50ms")
+	assert.Equal(t, context.DeadlineExceeded, <-cancelled)
+
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(t, files)
+}
+
+func TestRequestTimeoutMulti(t *testing.T) {
+	SetLogger(&testLogger{t})
+	dir, restore := tempDir(t)
+	defer restore()
+
+	h, cancelled := blockingHandler(t, WithRequestTimeout(50*time.Millisecond))
+	resp, b := postJSON(t, h, "application/zip", multi)
+	assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+	assert.Contains(t, string(b), "Request timed out after 50ms")
+	for range multi {
+		assert.Equal(t, context.DeadlineExceeded, <-cancelled)
+	}
+
+	// The workpath is removed before the response is written.
+	files, _ := ioutil.ReadDir(dir)
+	assert.Empty(t, files)
+}
+
+func TestClientGone(t *testing.T) {
+	SetLogger(&testLogger{t})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	h, cancelled := blockingHandler(t)
+	resp, _, _ := postJSONContext(ctx, h, "application/pdf", multi)
+	if resp != nil {
+		t.Fatalf("Expected the request to be abandoned, got status %d", resp.StatusCode)
+	}
+	for range multi {
+		select {
+		case err := <-cancelled:
+			assert.Equal(t, context.Canceled, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Render was not cancelled when the client went away")
+		}
+	}
+}
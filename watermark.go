@@ -0,0 +1,127 @@
+package pdfhandler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/StefanKjartansson/pdfhandler/internal/pdf"
+)
+
+const (
+	defaultWatermarkOpacity = 0.3
+	defaultWatermarkGray    = 0.5
+)
+
+// Watermark is text stamped diagonally across every page of a rendered pdf.
+// Text is stamped as is, except that a {name} placeholder for one of the
+// document's fields is replaced by its value, e.g. "Case {case_no}".
+type Watermark struct {
+	Text    string  `json:"text"`
+	Opacity float64 `json:"opacity,omitempty"`
+	Angle   float64 `json:"angle,omitempty"`
+	Size    float64 `json:"size,omitempty"`
+}
+
+// maxWatermarkLength caps the characters of a watermark, before and after
+// its placeholders are replaced.
+const maxWatermarkLength = 200
+
+var fieldPlaceholder = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// expandFields replaces the {name} placeholders in text with the values of
+// fields. Placeholders of unknown fields are left as they are.
+func expandFields(text string, fields map[string]string) string {
+	return fieldPlaceholder.ReplaceAllStringFunc(text, func(m string) string {
+		if v, ok := fields[m[1:len(m)-1]]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+// truncate cuts s to at most n characters.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+func (wm Watermark) check() error {
+	if n := utf8.RuneCountInString(wm.Text); n > maxWatermarkLength {
+		return fmt.Errorf("Watermark is %d characters long, exceeding the limit of %d characters", n, maxWatermarkLength)
+	}
+	return nil
+}
+
+// fitSize returns the font size at which text spans most of the line
+// through the center of box at the given angle.
+func fitSize(text []byte, box PageBox, angle float64) float64 {
+	rad := angle * math.Pi / 180
+	span := math.Inf(1)
+	if c := math.Abs(math.Cos(rad)); c > 1e-6 {
+		span = box.width() / c
+	}
+	if s := math.Abs(math.Sin(rad)); s > 1e-6 {
+		span = math.Min(span, box.height()/s)
+	}
+	w := pdf.HelveticaTextWidth(text, 1)
+	if w == 0 {
+		return 0
+	}
+	return math.Min(span*0.8/w, 144)
+}
+
+func (wm Watermark) marks(text string, media []PageMedia) []overlayPage {
+	opacity := wm.Opacity
+	if opacity <= 0 {
+		opacity = defaultWatermarkOpacity
+	}
+	pages := make([]overlayPage, len(media))
+	for i, m := range media {
+		size := wm.Size
+		if size <= 0 {
+			size = fitSize(pdf.WinAnsi(text), m.Rect, wm.Angle)
+		}
+		pages[i] = overlayPage{
+			Box: m.Rect,
+			Marks: []textMark{{
+				Text:    text,
+				X:       m.Rect.X1 + m.Rect.width()/2,
+				Y:       m.Rect.Y1 + m.Rect.height()/2,
+				Size:    size,
+				Angle:   wm.Angle,
+				Opacity: math.Min(opacity, 1),
+				Gray:    defaultWatermarkGray,
+			}},
+		}
+	}
+	return pages
+}
+
+// stamp generates an overlay sized to each page of the pdf in b and
+// stamps it on top.
+func (wm Watermark) stamp(ctx context.Context, r Renderer, w io.Writer, b []byte, p PDF) error {
+	text := truncate(expandFields(wm.Text, p.Fields), maxWatermarkLength)
+	if text == "" {
+		_, err := w.Write(b)
+		return err
+	}
+	d, err := r.DocData(ctx, b)
+	if err != nil {
+		return err
+	}
+	return stampOverlay(ctx, r, w, b, wm.marks(text, d.Media))
+}
+
+func stampOverlay(ctx context.Context, r Renderer, w io.Writer, b []byte, pages []overlayPage) error {
+	overlay, err := overlayPDF(pages)
+	if err != nil {
+		return err
+	}
+	return r.Stamp(ctx, w, b, overlay)
+}
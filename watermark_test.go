@@ -0,0 +1,50 @@
+package pdfhandler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWatermarkText(t *testing.T) {
+	fields := map[string]string{"case_no": "1234", "case name": "{{range 3}}A{{end}}"}
+	for text, expected := range map[string]string{
+		"CONFIDENTIAL - case {case_no}":   "CONFIDENTIAL - case 1234",
+		"{case name} {missing} {}":        "{{range 3}}A{{end}} {missing} {}",
+		"{{.Fields.case_no}} {{range 3}}": "{{.Fields.case_no}} {{range 3}}",
+	} {
+		if out := expandFields(text, fields); out != expected {
+			t.Fatalf("Expected %q, got %q", expected, out)
+		}
+	}
+	if out := truncate("CONFIDENTIAL", 4); out != "CONF" {
+		t.Fatalf("Got %q", out)
+	}
+	if err := (Watermark{Text: strings.Repeat("x", maxWatermarkLength+1)}).check(); err == nil {
+		t.Fatal("Expected an over long watermark to be rejected")
+	}
+}
+
+func TestOverlayPDF(t *testing.T) {
+	d := scanDocData(strings.NewReader(testDocData))
+	wm := Watermark{Text: "CONFIDENTIAL (draft)", Opacity: 0.2, Angle: 45}
+	b, err := overlayPDF(wm.marks(wm.Text, d.Media))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"/Count 2", "/MediaBox [0 0 612 792]", "/ca 0.2"} {
+		if !bytes.Contains(b, []byte(expected)) {
+			t.Fatalf("Expected overlay to contain %q", expected)
+		}
+	}
+	if !bytes.HasSuffix(b, []byte("%%EOF\n")) {
+		t.Fatal("Overlay is not terminated")
+	}
+}
+
+func TestTextMarkEncoding(t *testing.T) {
+	b := textMark{Text: "Draft™ … Š", Size: 10}.content("GS1")
+	if !bytes.Contains(b, []byte("(Draft\x99 \x85 \x8a) Tj")) {
+		t.Fatalf("Expected WinAnsi encoded text, got %q", b)
+	}
+}
@@ -0,0 +1,141 @@
+package pdfhandler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWebhookRetries = 5
+	defaultWebhookBackoff = time.Second
+	webhookTimeout        = 10 * time.Second
+)
+
+// webhookEvent is posted to a job's callback_url when it finishes.
+type webhookEvent struct {
+	// Type is job.done or job.failed.
+	Type  string       `json:"type"`
+	Job   jobInfo      `json:"job"`
+	Links webhookLinks `json:"links"`
+}
+
+// webhookLinks are the urls of a job's status and output, starting with
+// the handler's public url.
+type webhookLinks struct {
+	Status string `json:"status"`
+	Result string `json:"result,omitempty"`
+}
+
+// webhooks delivers signed job events, retrying failed deliveries with
+// exponential backoff.
+type webhooks struct {
+	secret  []byte
+	hosts   []string
+	retries int
+	backoff time.Duration
+	client  *http.Client
+}
+
+func newWebhooks(secret string, hosts []string, retries int, backoff time.Duration) *webhooks {
+	wh := &webhooks{
+		secret:  []byte(secret),
+		retries: retries,
+		backoff: backoff,
+	}
+	for _, h := range hosts {
+		wh.hosts = append(wh.hosts, strings.ToLower(h))
+	}
+	wh.client = &http.Client{
+		Timeout: webhookTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("Too many redirects")
+			}
+			return wh.checkHost(req.URL)
+		},
+	}
+	return wh
+}
+
+// check validates a callback url.
+func (wh *webhooks) check(callback string) error {
+	if len(wh.secret) == 0 {
+		return errors.New("Callbacks are not enabled")
+	}
+	u, err := url.Parse(callback)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Invalid callback_url %q", callback)
+	}
+	return wh.checkHost(u)
+}
+
+// checkHost validates that events may be posted to the host of u, which
+// has to match one of the allowed host patterns.
+func (wh *webhooks) checkHost(u *url.URL) error {
+	host, hostname := strings.ToLower(u.Host), strings.ToLower(u.Hostname())
+	for _, pattern := range wh.hosts {
+		if ok, _ := path.Match(pattern, host); ok {
+			return nil
+		}
+		if ok, _ := path.Match(pattern, hostname); ok {
+			return nil
+		}
+	}
+	return fmt.Errorf("Callbacks can not be posted to %s", u.Host)
+}
+
+// sign is the X-Signature header of body, its HMAC-SHA256 under the
+// secret.
+func (wh *webhooks) sign(body []byte) string {
+	mac := hmac.New(sha256.New, wh.secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliver posts e to callback until it is accepted with a 2xx status or
+// the retries run out.
+func (wh *webhooks) deliver(callback string, e webhookEvent) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	signature := wh.sign(body)
+	backoff := wh.backoff
+	for attempt := 0; ; attempt++ {
+		err = wh.post(callback, body, signature)
+		if err == nil || attempt >= wh.retries {
+			return err
+		}
+		logger.Errorf("Delivering %s of job %s to %s: %q, retrying in %s", e.Type, e.Job.ID, callback, err.Error(), backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (wh *webhooks) post(callback string, body []byte, signature string) error {
+	req, err := http.NewRequest("POST", callback, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Signature", signature)
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Callback answered %s", resp.Status)
+	}
+	return nil
+}
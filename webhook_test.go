@@ -0,0 +1,171 @@
+package pdfhandler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// receiver is a webhook endpoint that fails the first failures deliveries
+// and records the rest.
+type receiver struct {
+	*httptest.Server
+	mu         sync.Mutex
+	failures   int
+	attempts   int
+	bodies     [][]byte
+	signatures []string
+	events     chan webhookEvent
+}
+
+func newReceiver(failures int) *receiver {
+	r := &receiver{failures: failures, events: make(chan webhookEvent, 10)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.attempts++
+		if r.attempts <= r.failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := ioutil.ReadAll(req.Body)
+		r.bodies = append(r.bodies, b)
+		r.signatures = append(r.signatures, req.Header.Get("X-Signature"))
+		var e webhookEvent
+		json.Unmarshal(b, &e)
+		r.events <- e
+	}))
+	return r
+}
+
+func (r *receiver) event(t *testing.T) webhookEvent {
+	select {
+	case e := <-r.events:
+		return e
+	case <-time.After(10 * time.Second):
+		t.Fatal("No event delivered")
+	}
+	return webhookEvent{}
+}
+
+func TestWebhookSign(t *testing.T) {
+	wh := newWebhooks("secret", nil, 0, 0)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(`{"type":"job.done"}`))
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), wh.sign([]byte(`{"type":"job.done"}`)))
+}
+
+func TestWebhookDone(t *testing.T) {
+	SetLogger(&testLogger{t})
+	rcv := newReceiver(2)
+	defer rcv.Close()
+	s := jobServer(t, WithWebhookSecret("secret"), WithWebhookHosts("127.0.0.1"),
+		WithWebhookRetries(3, time.Millisecond), WithPublicURL("https://pdf.example.com/"))
+	defer s.Close()
+
+	var info jobInfo
+	resp := doJSON(t, "POST", s.URL+"/pdf/jobs", map[string]interface{}{
+		"documents":    multi,
+		"callback_url": rcv.URL,
+	}, &info)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	e := rcv.event(t)
+	assert.Equal(t, "job.done", e.Type)
+	assert.Equal(t, info.ID, e.Job.ID)
+	assert.Equal(t, jobDone, e.Job.Status)
+	assert.Equal(t, "https://pdf.example.com/pdf/jobs/"+info.ID, e.Links.Status)
+	assert.Equal(t, "https://pdf.example.com/pdf/jobs/"+info.ID+"/result", e.Links.Result)
+
+	rcv.mu.Lock()
+	assert.Equal(t, 3, rcv.attempts)
+	assert.Equal(t, newWebhooks("secret", nil, 0, 0).sign(rcv.bodies[0]), rcv.signatures[0])
+	rcv.mu.Unlock()
+
+	resp, err := http.Get(s.URL + strings.TrimPrefix(e.Links.Result, "https://pdf.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestWebhookFailed(t *testing.T) {
+	SetLogger(&testLogger{t})
+	rcv := newReceiver(0)
+	defer rcv.Close()
+	r, _ := testRenderer()
+	s := jobServer(t, WithRenderer(brokenRenderer{r}), WithWebhookSecret("secret"), WithWebhookHosts("127.0.0.1"))
+	defer s.Close()
+
+	broken := PDF{FileName: "OoPdfFormExample.pdf", Fields: map[string]string{"broken": "yes"}}
+	doJSON(t, "POST", s.URL+"/pdf/jobs", map[string]interface{}{
+		"documents":    []PDF{broken},
+		"callback_url": rcv.URL,
+	}, nil)
+	e := rcv.event(t)
+	assert.Equal(t, "job.failed", e.Type)
+	assert.Contains(t, e.Job.Error, "Document 0 (OoPdfFormExample.pdf) failed")
+	assert.Equal(t, "/pdf/jobs/"+e.Job.ID, e.Links.Status)
+	assert.Empty(t, e.Links.Result)
+}
+
+func TestWebhookGivesUp(t *testing.T) {
+	rcv := newReceiver(10)
+	defer rcv.Close()
+	wh := newWebhooks("secret", []string{"127.0.0.1"}, 2, time.Millisecond)
+	err := wh.deliver(rcv.URL, webhookEvent{Type: "job.done"})
+	assert.Error(t, err)
+	rcv.mu.Lock()
+	assert.Equal(t, 3, rcv.attempts)
+	rcv.mu.Unlock()
+}
+
+func TestWebhookInvalid(t *testing.T) {
+	SetLogger(&testLogger{t})
+	body := map[string]interface{}{"documents": multi, "callback_url": "http://example.com/hook"}
+
+	s := jobServer(t)
+	defer s.Close()
+	// No secret configured.
+	resp := doJSON(t, "POST", s.URL+"/pdf/jobs", body, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	s2 := jobServer(t, WithWebhookSecret("secret"), WithWebhookHosts("*.example.com"))
+	defer s2.Close()
+	resp = doJSON(t, "POST", s2.URL+"/pdf/", body, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	for _, callback := range []string{"ftp://hooks.example.com/hook", "http://example.com/hook", "http://127.0.0.1/hook"} {
+		body["callback_url"] = callback
+		resp = doJSON(t, "POST", s2.URL+"/pdf/jobs", body, nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, callback)
+	}
+	wh := newWebhooks("secret", []string{"*.example.com", "127.0.0.1:9000"}, 0, 0)
+	assert.NoError(t, wh.check("https://hooks.example.com:8443/hook"))
+	assert.NoError(t, wh.check("http://127.0.0.1:9000/hook"))
+	assert.Error(t, wh.check("http://127.0.0.1:9001/hook"))
+}
+
+func TestWebhookRedirect(t *testing.T) {
+	rcv := newReceiver(0)
+	defer rcv.Close()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, "http://example.com/hook", http.StatusTemporaryRedirect)
+	}))
+	defer s.Close()
+	wh := newWebhooks("secret", []string{"127.0.0.1"}, 0, 0)
+	err := wh.deliver(s.URL, webhookEvent{Type: "job.done"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Callbacks can not be posted to example.com")
+	}
+}